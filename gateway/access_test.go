@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowlists(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication: "bearer",
+			Token:          "partner",
+			ID:             "orgid",
+			AllowedPaths:   []string{"/prometheus/api/v1/query*"},
+			AllowedMethods: []string{"get", "POST"},
+		},
+		{Authentication: "bearer", Token: "internal", ID: "orgid"},
+	}})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("/prometheus/api/v1/query", authorize(FRONTEND, ok))
+	mux.Handle("/prometheus/api/v1/query_range", authorize(FRONTEND, ok))
+	mux.Handle("/api/v1/read", authorize(FRONTEND, ok))
+	mux.Handle("/ruler/delete_tenant_config", authorize(RULER, ok))
+	handler := auth.Wrap(mux)
+
+	testCases := []struct {
+		name           string
+		token          string
+		method         string
+		path           string
+		expectedStatus int
+		expectedReason string
+	}{
+		{
+			name:           "allowed path",
+			token:          "partner",
+			method:         "GET",
+			path:           "/prometheus/api/v1/query",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "allowed path with wildcard",
+			token:          "partner",
+			method:         "POST",
+			path:           "/prometheus/api/v1/query_range",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "remote read is not allowed",
+			token:          "partner",
+			method:         "POST",
+			path:           "/api/v1/read",
+			expectedStatus: http.StatusForbidden,
+			expectedReason: reasonPathNotAllowed,
+		},
+		{
+			name:           "delete endpoint is not allowed",
+			token:          "partner",
+			method:         "POST",
+			path:           "/ruler/delete_tenant_config",
+			expectedStatus: http.StatusForbidden,
+			expectedReason: reasonPathNotAllowed,
+		},
+		{
+			name:           "method is not allowed",
+			token:          "partner",
+			method:         "DELETE",
+			path:           "/prometheus/api/v1/query",
+			expectedStatus: http.StatusForbidden,
+			expectedReason: reasonMethodNotAllowed,
+		},
+		{
+			name:           "tenant without allowlists",
+			token:          "internal",
+			method:         "DELETE",
+			path:           "/ruler/delete_tenant_config",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedStatus, rw.Code)
+			if tc.expectedReason == "" {
+				return
+			}
+			assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+			var body denial
+			require.NoError(t, json.NewDecoder(rw.Body).Decode(&body))
+			assert.Equal(t, "error", body.Status)
+			assert.Equal(t, tc.expectedReason, body.Reason)
+			assert.NotEmpty(t, body.Error)
+		})
+	}
+}
+
+func TestInvalidAllowedPath(t *testing.T) {
+	_, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{Authentication: "bearer", Token: "token", AllowedPaths: []string{"/api/v1/[query"}},
+	}})
+	assert.ErrorContains(t, err, "invalid allowed path")
+}
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"sort"
+	"sync"
+	"time"
+)
+
+type cacheKey [sha256.Size]byte
+
+type cacheEntry[V any] struct {
+	value   V
+	expiry  time.Time
+	updated time.Time
+}
+
+// ttlCache is a size bounded map whose entries expire individually. When it is
+// full, expired entries are dropped first, then the least recently updated
+// ones.
+type ttlCache[V any] struct {
+	maxEntries int
+	// entries for which keep returns true are only dropped once they expired
+	keep    func(value V, now time.Time) bool
+	entries map[cacheKey]cacheEntry[V]
+	sync.Mutex
+}
+
+func newTTLCache[V any](maxEntries int) *ttlCache[V] {
+	return &ttlCache[V]{
+		maxEntries: maxEntries,
+		entries:    map[cacheKey]cacheEntry[V]{},
+	}
+}
+
+func (c *ttlCache[V]) get(key cacheKey) (V, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	if time.Now().After(entry.expiry) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// set stores the value, unless the cache is full of entries it has to keep.
+func (c *ttlCache[V]) set(key cacheKey, value V, expiry time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+		if len(c.entries) >= c.maxEntries {
+			return
+		}
+	}
+	c.entries[key] = cacheEntry[V]{value: value, expiry: expiry, updated: now}
+}
+
+// evict drops the expired entries. If that does not free up any room, a tenth
+// of the cache is dropped, least recently updated first, so that the following
+// insertions do not have to scan the cache again.
+func (c *ttlCache[V]) evict(now time.Time) {
+	type candidate struct {
+		key     cacheKey
+		updated time.Time
+	}
+	var candidates []candidate
+	for key, entry := range c.entries {
+		switch {
+		case now.After(entry.expiry):
+			delete(c.entries, key)
+		case c.keep == nil || !c.keep(entry.value, now):
+			candidates = append(candidates, candidate{key: key, updated: entry.updated})
+		}
+	}
+	if len(c.entries) < c.maxEntries {
+		return
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].updated.Before(candidates[j].updated)
+	})
+	n := min(max(c.maxEntries/10, 1), len(candidates))
+	for _, candidate := range candidates[:n] {
+		delete(c.entries, candidate.key)
+	}
+}
+
+func (c *ttlCache[V]) delete(key cacheKey) {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.entries, key)
+}
+
+func (c *ttlCache[V]) len() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return len(c.entries)
+}
+
+func newCacheKey(parts ...string) cacheKey {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	var key cacheKey
+	copy(key[:], h.Sum(nil))
+	return key
+}
@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTLCache(t *testing.T) {
+	cache := newTTLCache[string](2)
+	keys := []cacheKey{newCacheKey("a"), newCacheKey("b"), newCacheKey("c")}
+	expiry := time.Now().Add(time.Hour)
+
+	cache.set(keys[0], "a", expiry)
+	cache.set(keys[1], "b", expiry)
+	value, ok := cache.get(keys[0])
+	assert.True(t, ok)
+	assert.Equal(t, "a", value)
+
+	// overwriting an entry does not evict anything
+	cache.set(keys[1], "b2", expiry)
+	assert.Equal(t, 2, cache.len())
+	value, _ = cache.get(keys[1])
+	assert.Equal(t, "b2", value)
+
+	// the cache never grows beyond its maximum size
+	cache.set(keys[2], "c", expiry)
+	assert.LessOrEqual(t, cache.len(), 2)
+	value, ok = cache.get(keys[2])
+	assert.True(t, ok)
+	assert.Equal(t, "c", value)
+
+	cache.set(keys[0], "expired", time.Now().Add(-time.Second))
+	_, ok = cache.get(keys[0])
+	assert.False(t, ok)
+}
+
+func TestTTLCacheEviction(t *testing.T) {
+	cache := newTTLCache[int](10)
+	cache.keep = func(value int, now time.Time) bool { return value < 0 }
+	expiry := time.Now().Add(time.Hour)
+
+	keys := make([]cacheKey, 12)
+	for i := range keys {
+		keys[i] = newCacheKey(strconv.Itoa(i))
+	}
+	cache.set(keys[0], -1, expiry)
+	for i := 1; i < 10; i++ {
+		cache.set(keys[i], i, expiry)
+	}
+
+	// the least recently updated entry that is not kept is dropped
+	cache.set(keys[10], 10, expiry)
+	assert.Equal(t, 10, cache.len())
+	_, ok := cache.get(keys[1])
+	assert.False(t, ok)
+	for _, i := range []int{0, 2, 10} {
+		_, ok := cache.get(keys[i])
+		assert.True(t, ok)
+	}
+
+	// nothing is stored once every entry has to be kept
+	for i := 1; i < 11; i++ {
+		cache.set(keys[i], -1, expiry)
+	}
+	cache.set(keys[11], 11, expiry)
+	_, ok = cache.get(keys[11])
+	assert.False(t, ok)
+	_, ok = cache.get(keys[0])
+	assert.True(t, ok)
+}
+
+func TestNewCacheKey(t *testing.T) {
+	assert.Equal(t, newCacheKey("a", "b"), newCacheKey("a", "b"))
+	assert.NotEqual(t, newCacheKey("ab", "c"), newCacheKey("a", "bc"))
+}
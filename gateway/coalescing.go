@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// maxCoalescedResponseSize caps the copy of a response kept for the waiting
+// requests. They forward their own request when the response is larger.
+const maxCoalescedResponseSize = 10 << 20
+
+// flight is a request in progress whose response is shared with the
+// identical requests that arrive before it completes.
+type flight struct {
+	done    chan struct{}
+	waiters int
+	// shared is false when the response could not be shared, because the
+	// request failed or its response was too large
+	shared bool
+	status int
+	header http.Header
+	body   []byte
+}
+
+// Coalescer forwards only one of the identical requests of a tenant that are
+// in flight at the same time, and sends its response to all of them. Requests
+// are identical when their X-Scope-OrgID, method, path, parameters and
+// accepted encodings are. The forwarded request is not canceled when its own
+// client goes away while others wait for the response.
+type Coalescer struct {
+	flights   map[cacheKey]*flight
+	coalesced prometheus.Counter
+	sync.Mutex
+}
+
+func NewCoalescer(reg prometheus.Registerer) *Coalescer {
+	return &Coalescer{
+		flights: map[cacheKey]*flight{},
+		coalesced: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "gateway_coalesced_requests_total",
+			Help:      "Requests to the query frontend served with the response of an identical request in flight.",
+		}),
+	}
+}
+
+func (c *Coalescer) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && !isFormRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		params, err := queryParams(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := newCacheKey(r.Header.Get("X-Scope-OrgID"), r.Method, r.URL.Path, params.Encode(), r.Header.Get("Accept-Encoding"))
+
+		c.Lock()
+		if f, ok := c.flights[key]; ok {
+			f.waiters++
+			c.Unlock()
+			c.coalesced.Inc()
+			c.wait(w, r, next, f)
+			return
+		}
+		f := &flight{done: make(chan struct{})}
+		c.flights[key] = f
+		c.Unlock()
+		c.forward(w, r, next, key, f)
+	})
+}
+
+// wait serves the response of the flight, or forwards the request on its own
+// when the response cannot be shared.
+func (c *Coalescer) wait(w http.ResponseWriter, r *http.Request, next http.Handler, f *flight) {
+	select {
+	case <-f.done:
+	case <-r.Context().Done():
+		c.Lock()
+		f.waiters--
+		c.Unlock()
+		return
+	}
+
+	if !f.shared {
+		next.ServeHTTP(w, r)
+		return
+	}
+	for name, values := range f.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(f.status)
+	w.Write(f.body)
+}
+
+// forward sends the request upstream with a context its client cannot cancel,
+// so that the waiting requests get a response when it goes away. It is only
+// canceled when nobody is waiting.
+func (c *Coalescer) forward(w http.ResponseWriter, r *http.Request, next http.Handler, key cacheKey, f *flight) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+	go func() {
+		select {
+		case <-r.Context().Done():
+			c.Lock()
+			if f.waiters == 0 {
+				// later requests start a flight of their own
+				c.remove(key, f)
+				cancel()
+			}
+			c.Unlock()
+		case <-ctx.Done():
+		}
+	}()
+
+	capture := &flightCapture{ResponseWriter: w, status: http.StatusOK}
+	completed := false
+	defer func() {
+		c.Lock()
+		c.remove(key, f)
+		c.Unlock()
+		// a panic, such as the proxy aborting a response, leaves a partial
+		// response the waiting requests must not get
+		if completed && !capture.overflow {
+			f.shared = true
+			f.status = capture.status
+			f.header = w.Header().Clone()
+			f.body = capture.body.Bytes()
+		}
+		close(f.done)
+	}()
+	next.ServeHTTP(capture, r.WithContext(ctx))
+	completed = true
+}
+
+func (c *Coalescer) remove(key cacheKey, f *flight) {
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+}
+
+// flightCapture keeps a copy of the response it writes through, up to
+// maxCoalescedResponseSize bytes. Once its client is gone, the response is
+// still read to the end for the waiting requests.
+type flightCapture struct {
+	http.ResponseWriter
+	status     int
+	body       bytes.Buffer
+	overflow   bool
+	clientGone bool
+}
+
+func (c *flightCapture) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *flightCapture) Write(b []byte) (int, error) {
+	if !c.overflow {
+		if c.body.Len()+len(b) > maxCoalescedResponseSize {
+			c.overflow = true
+			c.body = bytes.Buffer{}
+		} else {
+			c.body.Write(b)
+		}
+	}
+	if !c.clientGone {
+		if _, err := c.ResponseWriter.Write(b); err != nil {
+			c.clientGone = true
+		}
+	}
+	return len(b), nil
+}
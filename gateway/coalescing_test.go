@@ -0,0 +1,243 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalescer(t *testing.T) {
+	coalescer := NewCoalescer(prometheus.NewRegistry())
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := coalescer.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(r.URL.Query().Get("query")))
+	}))
+
+	query := func(orgID, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://localhost"+target, nil)
+		req.Header.Set("X-Scope-OrgID", orgID)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 5)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = query("team-a", "/prometheus/api/v1/query?query=up")
+		}(i)
+	}
+	// a different tenant or query is forwarded on its own
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assert.Equal(t, "up", query("team-b", "/prometheus/api/v1/query?query=up").Body.String())
+	}()
+	go func() {
+		defer wg.Done()
+		assert.Equal(t, "down", query("team-a", "/prometheus/api/v1/query?query=down").Body.String())
+	}()
+
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(coalescer.coalesced) == 4 && calls.Load() == 3
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, rw := range responses {
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "up", rw.Body.String())
+		assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+	}
+
+	// requests after the first completed are forwarded again
+	query("team-a", "/prometheus/api/v1/query?query=up")
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestCoalescerAbortedRequest(t *testing.T) {
+	coalescer := NewCoalescer(prometheus.NewRegistry())
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	handler := coalescer.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		if calls.Add(1) == 1 {
+			w.Write([]byte("partial"))
+			panic(http.ErrAbortHandler)
+		}
+		w.Write([]byte("up"))
+	}))
+
+	go func() {
+		defer func() { recover() }()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query=up", nil))
+	}()
+	assert.Eventually(t, func() bool {
+		coalescer.Lock()
+		defer coalescer.Unlock()
+		return len(coalescer.flights) == 1
+	}, time.Second, time.Millisecond)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query=up", nil))
+		done <- rw
+	}()
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(coalescer.coalesced) == 1
+	}, time.Second, time.Millisecond)
+	close(release)
+
+	// the waiting request is forwarded on its own
+	rw := <-done
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "up", rw.Body.String())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCoalescerCanceledFirstRequest(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+			w.Write([]byte("up"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	target, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	coalescer := NewCoalescer(prometheus.NewRegistry())
+	handler := coalescer.Wrap(httputil.NewSingleHostReverseProxy(target))
+	inFlight := func(n int) func() bool {
+		return func() bool {
+			coalescer.Lock()
+			defer coalescer.Unlock()
+			return len(coalescer.flights) == n
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan struct{})
+	go func() {
+		defer close(first)
+		req := httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query=up", nil).WithContext(ctx)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	assert.Eventually(t, inFlight(1), time.Second, time.Millisecond)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query=up", nil))
+		done <- rw
+	}()
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(coalescer.coalesced) == 1
+	}, time.Second, time.Millisecond)
+
+	// the client of the forwarded request goes away, the upstream request goes on
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	rw := <-done
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "up", rw.Body.String())
+	<-first
+}
+
+func TestCoalescerCanceledAlone(t *testing.T) {
+	canceled := make(chan struct{})
+	coalescer := NewCoalescer(prometheus.NewRegistry())
+	handler := coalescer.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(canceled)
+	}))
+
+	// without waiting requests, the forwarded request ends with its client
+	ctx, cancel := context.WithCancel(context.Background())
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query=up", nil).WithContext(ctx))
+	cancel()
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("the forwarded request was not canceled")
+	}
+}
+
+func TestCoalescerLargeResponse(t *testing.T) {
+	coalescer := NewCoalescer(prometheus.NewRegistry())
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	handler := coalescer.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write(make([]byte, maxCoalescedResponseSize+1))
+	}))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query=up", nil))
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query=up", nil))
+		done <- rw
+	}()
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(coalescer.coalesced) == 1
+	}, time.Second, time.Millisecond)
+	close(release)
+
+	// a response too large to keep is not shared
+	rw := <-done
+	assert.Equal(t, maxCoalescedResponseSize+1, rw.Body.Len())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCoalescerCanceledWaiter(t *testing.T) {
+	coalescer := NewCoalescer(prometheus.NewRegistry())
+
+	release := make(chan struct{})
+	handler := coalescer.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer close(release)
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query=up", nil))
+	assert.Eventually(t, func() bool {
+		coalescer.Lock()
+		defer coalescer.Unlock()
+		return len(coalescer.flights) == 1
+	}, time.Second, time.Millisecond)
+
+	// a waiting request gives up with its client
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query=up", nil).WithContext(ctx)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultQueueTimeout = 10 * time.Second
+
+func (c *QueryConcurrency) init() error {
+	if c.MaxInFlight < 0 || c.MaxQueued < 0 || c.QueueTimeout < 0 {
+		return fmt.Errorf("query concurrency limits must not be negative")
+	}
+	if c.MaxQueued > 0 && c.MaxInFlight == 0 {
+		return fmt.Errorf("query concurrency max_queued requires max_in_flight")
+	}
+	if c.QueueTimeout == 0 {
+		c.QueueTimeout = defaultQueueTimeout
+	}
+	return nil
+}
+
+type semaphore struct {
+	slots   chan struct{}
+	waiting int
+	// requests holding or waiting for a slot, the semaphore is dropped once
+	// there are none
+	users int
+}
+
+// ConcurrencyLimiter caps the queries in flight per limitKey. Requests over
+// the cap wait in a bounded queue for up to queue_timeout and are rejected
+// with 429 when the queue is full or the wait times out.
+type ConcurrencyLimiter struct {
+	semaphores map[string]*semaphore
+	sync.Mutex
+}
+
+func NewConcurrencyLimiter() *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		semaphores: map[string]*semaphore{},
+	}
+}
+
+func (l *ConcurrencyLimiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := identityFrom(r.Context())
+		if !ok || id.tenant.QueryConcurrency.MaxInFlight == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := id.limitKey(r)
+		if err := l.acquire(r.Context(), key, id.tenant.QueryConcurrency); err != nil {
+			logrus.Debugf("rejecting a query of tenant %s: %v", r.Header.Get("X-Scope-OrgID"), err)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		defer l.release(key)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *ConcurrencyLimiter) acquire(ctx context.Context, key string, limits QueryConcurrency) error {
+	l.Lock()
+	sem, ok := l.semaphores[key]
+	if !ok {
+		sem = &semaphore{slots: make(chan struct{}, limits.MaxInFlight)}
+		l.semaphores[key] = sem
+	}
+	sem.users++
+
+	select {
+	case sem.slots <- struct{}{}:
+		l.Unlock()
+		return nil
+	default:
+	}
+	if sem.waiting >= limits.MaxQueued {
+		l.leave(key, sem)
+		l.Unlock()
+		return fmt.Errorf("%d queries in flight and %d queued", cap(sem.slots), sem.waiting)
+	}
+	sem.waiting++
+	l.Unlock()
+
+	timer := time.NewTimer(limits.QueueTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case sem.slots <- struct{}{}:
+	case <-timer.C:
+		err = fmt.Errorf("timed out after %s in the queue", limits.QueueTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	sem.waiting--
+	if err != nil {
+		l.leave(key, sem)
+	}
+	return err
+}
+
+func (l *ConcurrencyLimiter) release(key string) {
+	l.Lock()
+	defer l.Unlock()
+
+	sem := l.semaphores[key]
+	<-sem.slots
+	l.leave(key, sem)
+}
+
+// leave must be called with the lock held.
+func (l *ConcurrencyLimiter) leave(key string, sem *semaphore) {
+	sem.users--
+	if sem.users == 0 {
+		delete(l.semaphores, key)
+	}
+}
@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (l *ConcurrencyLimiter) waiting(key string) int {
+	l.Lock()
+	defer l.Unlock()
+
+	if sem, ok := l.semaphores[key]; ok {
+		return sem.waiting
+	}
+	return 0
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication:   "bearer",
+			Token:            "heavy",
+			ID:               "heavy",
+			QueryConcurrency: QueryConcurrency{MaxInFlight: 2, MaxQueued: 1, QueueTimeout: time.Second},
+		},
+		{Authentication: "bearer", Token: "light", ID: "light"},
+	}})
+	require.NoError(t, err)
+
+	limiter := NewConcurrencyLimiter()
+	started := make(chan string, 10)
+	unblock := make(chan struct{})
+	handler := auth.Wrap(limiter.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgID := r.Header.Get("X-Scope-OrgID")
+		started <- orgID
+		if orgID != "light" {
+			<-unblock
+		}
+	})))
+
+	query := func(token string) int {
+		req := httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	var wg sync.WaitGroup
+	statuses := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- query("heavy")
+		}()
+	}
+	<-started
+	<-started
+	require.Eventually(t, func() bool { return limiter.waiting("heavy") == 1 }, time.Second, time.Millisecond)
+
+	// the queue is full
+	assert.Equal(t, http.StatusTooManyRequests, query("heavy"))
+	// other tenants are not affected
+	assert.Equal(t, http.StatusOK, query("light"))
+	assert.Equal(t, "light", <-started)
+
+	// the queued query runs once a slot frees up
+	unblock <- struct{}{}
+	assert.Equal(t, "heavy", <-started)
+	close(unblock)
+	wg.Wait()
+	close(statuses)
+	for status := range statuses {
+		assert.Equal(t, http.StatusOK, status)
+	}
+	assert.Empty(t, limiter.semaphores)
+}
+
+func TestConcurrencyLimiterPassthrough(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication:   "bearer",
+			Token:            "passthrough",
+			Passthrough:      true,
+			QueryConcurrency: QueryConcurrency{MaxInFlight: 1},
+		},
+	}})
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	handler := auth.Wrap(NewConcurrencyLimiter().Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-unblock
+	})))
+
+	query := func(orgID string) int {
+		req := httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query", nil)
+		req.Header.Set("Authorization", "Bearer passthrough")
+		req.Header.Set("X-Scope-OrgID", orgID)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	done := make(chan int)
+	go func() { done <- query("team-1") }()
+	<-started
+
+	// another org ID does not get its own slots
+	assert.Equal(t, http.StatusTooManyRequests, query("team-2"))
+	close(unblock)
+	assert.Equal(t, http.StatusOK, <-done)
+}
+
+func TestConcurrencyLimiterQueueTimeout(t *testing.T) {
+	limiter := NewConcurrencyLimiter()
+	limits := QueryConcurrency{MaxInFlight: 1, MaxQueued: 1, QueueTimeout: 50 * time.Millisecond}
+
+	require.NoError(t, limiter.acquire(context.Background(), "orgid", limits))
+	start := time.Now()
+	assert.ErrorContains(t, limiter.acquire(context.Background(), "orgid", limits), "timed out")
+	assert.GreaterOrEqual(t, time.Since(start), limits.QueueTimeout)
+
+	// a cancelled request leaves the queue
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, limiter.acquire(ctx, "orgid", limits), context.Canceled)
+	assert.Equal(t, 0, limiter.waiting("orgid"))
+
+	limiter.release("orgid")
+	assert.Empty(t, limiter.semaphores)
+}
+
+func TestQueryConcurrencyInit(t *testing.T) {
+	c := QueryConcurrency{MaxInFlight: 4, MaxQueued: 10}
+	require.NoError(t, c.init())
+	assert.Equal(t, defaultQueueTimeout, c.QueueTimeout)
+
+	c = QueryConcurrency{MaxQueued: 10}
+	assert.Error(t, c.init())
+
+	c = QueryConcurrency{MaxInFlight: -1}
+	assert.Error(t, c.init())
+}
@@ -2,19 +2,25 @@ package gateway
 
 import (
 	"os"
+	"regexp"
 	"time"
 
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	Server        ServerConfig `yaml:"server"`
-	Admin         ServerConfig `yaml:"admin"`
-	Tenants       []Tenant     `yaml:"tenants"`
-	Distributor   Upstream     `yaml:"distributor"`
-	QueryFrontend Upstream     `yaml:"frontend"`
-	Alertmanager  Upstream     `yaml:"alertmanager"`
-	Ruler         Upstream     `yaml:"ruler"`
+	Server          ServerConfig     `yaml:"server"`
+	Admin           ServerConfig     `yaml:"admin"`
+	Tenants         []Tenant         `yaml:"tenants"`
+	Distributor     Upstream         `yaml:"distributor"`
+	QueryFrontend   Upstream         `yaml:"frontend"`
+	Alertmanager    Upstream         `yaml:"alertmanager"`
+	Ruler           Upstream         `yaml:"ruler"`
+	Lockout         LockoutConfig    `yaml:"lockout"`
+	QueryCache      QueryCacheConfig `yaml:"query_cache"`
+	CoalesceQueries bool             `yaml:"coalesce_queries"`
 }
 
 type Upstream struct {
@@ -33,14 +39,171 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `yaml:"http_server_read_timeout"`
 	WriteTimeout time.Duration `yaml:"http_server_write_timeout"`
 	IdleTimeout  time.Duration `yaml:"http_server_idle_timeout"`
+	TLS          TLSConfig     `yaml:"tls"`
+}
+
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+type LockoutConfig struct {
+	MaxFailures        int           `yaml:"max_failures"`
+	FailureWindow      time.Duration `yaml:"failure_window"`
+	LockoutDuration    time.Duration `yaml:"lockout_duration"`
+	MaxLockoutDuration time.Duration `yaml:"max_lockout_duration"`
+}
+
+type QueryCacheConfig struct {
+	MaxSizeBytes      int64         `yaml:"max_size_bytes"`
+	MaxEntrySizeBytes int64         `yaml:"max_entry_size_bytes"`
+	MaxStaleness      time.Duration `yaml:"max_staleness"`
 }
 
 type Tenant struct {
-	Authentication string `yaml:"authentication"`
-	Username       string `yaml:"username"`
-	Password       string `yaml:"password"`
-	ID             string `yaml:"id"`
-	Passthrough    bool   `yaml:"passthrough"`
+	Authentication    string               `yaml:"authentication"`
+	Username          string               `yaml:"username"`
+	Password          string               `yaml:"password"`
+	PasswordHash      string               `yaml:"password_hash"`
+	HtpasswdFile      string               `yaml:"htpasswd_file"`
+	Token             string               `yaml:"token"`
+	ID                string               `yaml:"id"`
+	Passthrough       bool                 `yaml:"passthrough"`
+	JWT               JWTConfig            `yaml:"jwt"`
+	OIDC              OIDCConfig           `yaml:"oidc"`
+	MTLS              MTLSConfig           `yaml:"mtls"`
+	ExtAuthz          ExtAuthzConfig       `yaml:"ext_authz"`
+	Introspection     IntrospectionConfig  `yaml:"introspection"`
+	APIKey            APIKeyConfig         `yaml:"api_key"`
+	Credentials       []Credential         `yaml:"credentials"`
+	Roles             []string             `yaml:"roles"`
+	AllowedPaths      []string             `yaml:"allowed_paths"`
+	AllowedMethods    []string             `yaml:"allowed_methods"`
+	ReadTenantIDs     []string             `yaml:"read_tenant_ids"`
+	AllowedOrgIDs     []string             `yaml:"allowed_org_ids"`
+	RateLimits        map[string]RateLimit `yaml:"rate_limits"`
+	IngestionLimits   IngestionLimits      `yaml:"ingestion_limits"`
+	QueryConcurrency  QueryConcurrency     `yaml:"query_concurrency"`
+	RemoteWriteLimits RemoteWriteLimits    `yaml:"remote_write_limits"`
+	RelabelConfigs    []*relabel.Config    `yaml:"relabel_configs"`
+	LabelMatchers     []string             `yaml:"label_matchers"`
+	QueryLimits       QueryLimits          `yaml:"query_limits"`
+	QueryPolicy       QueryPolicy          `yaml:"query_policy"`
+
+	credentials   []Credential
+	labelMatchers []*labels.Matcher
+	verifications *ttlCache[struct{}]
+	jwtVerifier   *jwtVerifier
+	extAuthz      *extAuthzClient
+	introspection *introspectionClient
+}
+
+// Credential is one of possibly several secrets a tenant accepts, which allows
+// overlapping old and new secrets while they are being rotated.
+type Credential struct {
+	Username      string    `yaml:"username"`
+	Password      string    `yaml:"password"`
+	PasswordHash  string    `yaml:"password_hash"`
+	Token         string    `yaml:"token"`
+	Key           string    `yaml:"key"`
+	NotBefore     time.Time `yaml:"not_before"`
+	NotAfter      time.Time `yaml:"not_after"`
+	Roles         []string  `yaml:"roles"`
+	ReadTenantIDs []string  `yaml:"read_tenant_ids"`
+	AllowedOrgIDs []string  `yaml:"allowed_org_ids"`
+	LabelMatchers []string  `yaml:"label_matchers"`
+
+	labelMatchers []*labels.Matcher
+}
+
+type RateLimit struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+type IngestionLimits struct {
+	MaxBodySize    int64   `yaml:"max_body_size"`
+	BytesPerSecond float64 `yaml:"bytes_per_second"`
+	BurstBytes     int64   `yaml:"burst_bytes"`
+}
+
+type QueryConcurrency struct {
+	MaxInFlight  int           `yaml:"max_in_flight"`
+	MaxQueued    int           `yaml:"max_queued"`
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+}
+
+type QueryLimits struct {
+	MaxRange           time.Duration `yaml:"max_range"`
+	MinStep            time.Duration `yaml:"min_step"`
+	MaxPointsPerSeries int           `yaml:"max_points_per_series"`
+	MaxLookback        time.Duration `yaml:"max_lookback"`
+}
+
+type QueryPolicy struct {
+	DenyRegexNameOnly      bool     `yaml:"deny_regex_name_only"`
+	RequireEqualityMatcher bool     `yaml:"require_equality_matcher"`
+	DeniedFunctions        []string `yaml:"denied_functions"`
+	MaxCost                float64  `yaml:"max_cost"`
+}
+
+type RemoteWriteLimits struct {
+	MaxSeriesPerRequest    int      `yaml:"max_series_per_request"`
+	MaxSamplesPerRequest   int      `yaml:"max_samples_per_request"`
+	MaxLabelNamesPerSeries int      `yaml:"max_label_names_per_series"`
+	MaxLabelNameLength     int      `yaml:"max_label_name_length"`
+	MaxLabelValueLength    int      `yaml:"max_label_value_length"`
+	AllowedMetricNames     []string `yaml:"allowed_metric_names"`
+	DeniedMetricNames      []string `yaml:"denied_metric_names"`
+
+	allowedMetricNames []*regexp.Regexp
+	deniedMetricNames  []*regexp.Regexp
+}
+
+type JWTConfig struct {
+	JWKSFile      string `yaml:"jwks_file"`
+	KeyFile       string `yaml:"key_file"`
+	Issuer        string `yaml:"issuer"`
+	Audience      string `yaml:"audience"`
+	TenantIDClaim string `yaml:"tenant_id_claim"`
+}
+
+type APIKeyConfig struct {
+	Key        string `yaml:"key"`
+	Header     string `yaml:"header"`
+	QueryParam string `yaml:"query_param"`
+}
+
+type MTLSConfig struct {
+	SubjectCN   string `yaml:"subject_cn"`
+	URISAN      string `yaml:"uri_san"`
+	Fingerprint string `yaml:"fingerprint"`
+}
+
+type ExtAuthzConfig struct {
+	URL             string        `yaml:"url"`
+	Timeout         time.Duration `yaml:"timeout"`
+	CacheTTL        time.Duration `yaml:"cache_ttl"`
+	FailureMode     string        `yaml:"failure_mode"`
+	TenantIDHeader  string        `yaml:"tenant_id_header"`
+	ResponseHeaders []string      `yaml:"response_headers"`
+}
+
+type IntrospectionConfig struct {
+	URL           string        `yaml:"url"`
+	ClientID      string        `yaml:"client_id"`
+	ClientSecret  string        `yaml:"client_secret"`
+	TenantIDField string        `yaml:"tenant_id_field"`
+	Timeout       time.Duration `yaml:"timeout"`
+	MaxCacheTTL   time.Duration `yaml:"max_cache_ttl"`
+}
+
+type OIDCConfig struct {
+	IssuerURL           string        `yaml:"issuer_url"`
+	Audience            string        `yaml:"audience"`
+	TenantIDClaim       string        `yaml:"tenant_id_claim"`
+	JWKSRefreshInterval time.Duration `yaml:"jwks_refresh_interval"`
 }
 
 func Init(filePath string) (Config, error) {
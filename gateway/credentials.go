@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// initCredentials merges the tenant's top level secret, its htpasswd file and
+// its credentials list into a single list of credentials.
+func (tenant *Tenant) initCredentials() error {
+	credentials := append([]Credential(nil), tenant.Credentials...)
+
+	switch tenant.Authentication {
+	case "basic":
+		if tenant.Password != "" && (tenant.PasswordHash != "" || tenant.HtpasswdFile != "") {
+			return fmt.Errorf("tenant %s: password cannot be combined with password_hash or htpasswd_file", tenant.ID)
+		}
+		if tenant.PasswordHash != "" {
+			if tenant.Username == "" {
+				return fmt.Errorf("tenant %s: password_hash requires a username", tenant.ID)
+			}
+			credentials = append(credentials, Credential{Username: tenant.Username, PasswordHash: tenant.PasswordHash})
+		}
+		if tenant.HtpasswdFile != "" {
+			hashes, err := loadHtpasswd(tenant.HtpasswdFile)
+			if err != nil {
+				return err
+			}
+			for username, hash := range hashes {
+				// a configured username restricts the tenant to that entry of the file
+				if tenant.Username == "" || tenant.Username == username {
+					credentials = append(credentials, Credential{Username: username, PasswordHash: hash})
+				}
+			}
+		}
+		if tenant.PasswordHash == "" && tenant.HtpasswdFile == "" && (tenant.Username != "" || tenant.Password != "") {
+			credentials = append(credentials, Credential{Username: tenant.Username, Password: tenant.Password})
+		}
+	case "bearer":
+		if tenant.Token != "" {
+			credentials = append(credentials, Credential{Token: tenant.Token})
+		}
+	case "api_key":
+		if tenant.APIKey.Key != "" {
+			credentials = append(credentials, Credential{Key: tenant.APIKey.Key})
+		}
+	}
+
+	for i, credential := range credentials {
+		err := credential.validate(tenant.Authentication)
+		if err == nil {
+			err = tenant.validateReadTenantIDs(credential.ReadTenantIDs)
+		}
+		if err == nil {
+			err = tenant.validateAllowedOrgIDs(credential.AllowedOrgIDs)
+		}
+		if err == nil {
+			credentials[i].labelMatchers, err = parseLabelMatchers(credential.LabelMatchers)
+		}
+		if err != nil {
+			return fmt.Errorf("tenant %s, credential %d: %v", tenant.ID, i, err)
+		}
+	}
+
+	tenant.credentials = credentials
+	tenant.verifications = newTTLCache[struct{}](verificationCacheMaxEntries)
+	return nil
+}
+
+func (c Credential) validate(authentication string) error {
+	switch authentication {
+	case "basic":
+		if c.Username == "" {
+			return fmt.Errorf("basic credentials require a username")
+		}
+		if c.Password != "" && c.PasswordHash != "" {
+			return fmt.Errorf("password and password_hash are mutually exclusive")
+		}
+		if c.Password == "" && c.PasswordHash == "" {
+			return fmt.Errorf("basic credentials require a password or password_hash")
+		}
+		if c.PasswordHash != "" {
+			if err := validateHash(c.PasswordHash); err != nil {
+				return err
+			}
+		}
+	case "bearer":
+		if c.Token == "" {
+			return fmt.Errorf("bearer credentials require a token")
+		}
+	case "api_key":
+		if c.Key == "" {
+			return fmt.Errorf("api_key credentials require a key")
+		}
+	}
+
+	if !c.NotBefore.IsZero() && !c.NotAfter.IsZero() && !c.NotAfter.After(c.NotBefore) {
+		return fmt.Errorf("not_after must be later than not_before")
+	}
+	return validateRoles(c.Roles)
+}
+
+// validAt returns the reason why the credential cannot be used at the given
+// time, or an empty string when it can.
+func (c Credential) validAt(now time.Time) string {
+	if !c.NotBefore.IsZero() && now.Before(c.NotBefore) {
+		return fmt.Sprintf("not valid before %s", c.NotBefore.Format(time.RFC3339))
+	}
+	if !c.NotAfter.IsZero() && !now.Before(c.NotAfter) {
+		return fmt.Sprintf("expired at %s", c.NotAfter.Format(time.RFC3339))
+	}
+	return ""
+}
+
+// activeCredential returns the first credential that matches and is within
+// its validity window. Matching credentials outside their window are logged,
+// so that clients still sending a rotated secret can be tracked down.
+func (tenant *Tenant) activeCredential(matches func(*Credential) bool) *Credential {
+	now := time.Now()
+	reason := ""
+	for i := range tenant.credentials {
+		credential := &tenant.credentials[i]
+		if !matches(credential) {
+			continue
+		}
+		reason = credential.validAt(now)
+		if reason == "" {
+			return credential
+		}
+	}
+
+	if reason != "" {
+		logrus.Warnf("rejected a credential of tenant %s: %s", tenant.ID, reason)
+	}
+	return nil
+}
+
+func (tenant *Tenant) matchBasic(username, password string) *Credential {
+	return tenant.activeCredential(func(c *Credential) bool {
+		if c.PasswordHash == "" {
+			return c.saveCompare(username, password)
+		}
+		// only pay for a hash verification when the username matches
+		return c.Username == username && tenant.verifyPassword(c, password)
+	})
+}
+
+func (tenant *Tenant) matchToken(token string) *Credential {
+	return tenant.activeCredential(func(c *Credential) bool {
+		return c.Token != "" && subtle.ConstantTimeCompare([]byte(c.Token), []byte(token)) == 1
+	})
+}
+
+func (tenant *Tenant) matchKey(key string) *Credential {
+	return tenant.activeCredential(func(c *Credential) bool {
+		return c.Key != "" && subtle.ConstantTimeCompare([]byte(c.Key), []byte(key)) == 1
+	})
+}
+
+// verifyPassword caches successful verifications so that slow hashes are not
+// recomputed on every request. Failures are never cached.
+func (tenant *Tenant) verifyPassword(c *Credential, password string) bool {
+	key := newCacheKey(c.Username, c.PasswordHash, password)
+	if _, ok := tenant.verifications.get(key); ok {
+		return true
+	}
+	if !verifyHash(c.PasswordHash, password) {
+		return false
+	}
+	tenant.verifications.set(key, struct{}{}, time.Now().Add(verificationCacheTTL))
+	return true
+}
+
+// attempt to mitigate timing attacks
+func (c *Credential) saveCompare(username, password string) bool {
+	userNameCheck := subtle.ConstantTimeCompare([]byte(c.Username), []byte(username))
+	passwordCheck := subtle.ConstantTimeCompare([]byte(c.Password), []byte(password))
+	if userNameCheck == 1 && passwordCheck == 1 {
+		return true
+	}
+	return false
+}
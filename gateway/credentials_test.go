@@ -0,0 +1,194 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialRotation(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	testCases := []struct {
+		name           string
+		tenant         Tenant
+		setAuth        func(r *http.Request)
+		expectedStatus int
+	}{
+		{
+			name: "old password during the overlap",
+			tenant: Tenant{Authentication: "basic", ID: "orgid", Credentials: []Credential{
+				{Username: "user", Password: "old", NotAfter: future},
+				{Username: "user", Password: "new", NotBefore: past},
+			}},
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("user", "old") },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "new password during the overlap",
+			tenant: Tenant{Authentication: "basic", ID: "orgid", Credentials: []Credential{
+				{Username: "user", Password: "old", NotAfter: future},
+				{Username: "user", Password: "new", NotBefore: past},
+			}},
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("user", "new") },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "expired password",
+			tenant: Tenant{Authentication: "basic", ID: "orgid", Credentials: []Credential{
+				{Username: "user", Password: "old", NotAfter: past},
+				{Username: "user", Password: "new"},
+			}},
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("user", "old") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "password not yet valid",
+			tenant: Tenant{Authentication: "basic", ID: "orgid", Credentials: []Credential{
+				{Username: "user", Password: "new", NotBefore: future},
+			}},
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("user", "new") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "hashed credential alongside the top level password",
+			tenant: Tenant{Authentication: "basic", ID: "orgid", Username: "user", Password: "old", Credentials: []Credential{
+				{Username: "user", PasswordHash: bcryptHash(t, "new")},
+			}},
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("user", "new") },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "rotated bearer token",
+			tenant: Tenant{Authentication: "bearer", ID: "orgid", Token: "old", Credentials: []Credential{
+				{Token: "new", NotBefore: past},
+			}},
+			setAuth:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer new") },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "expired bearer token",
+			tenant: Tenant{Authentication: "bearer", ID: "orgid", Credentials: []Credential{
+				{Token: "old", NotAfter: past},
+			}},
+			setAuth:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer old") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "rotated api key",
+			tenant: Tenant{Authentication: "api_key", ID: "orgid", Credentials: []Credential{
+				{Key: "old", NotAfter: past},
+				{Key: "new", NotBefore: past, NotAfter: future},
+			}},
+			setAuth:        func(r *http.Request) { r.Header.Set(defaultAPIKeyHeader, "new") },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "expired api key",
+			tenant: Tenant{Authentication: "api_key", ID: "orgid", Credentials: []Credential{
+				{Key: "old", NotAfter: past},
+				{Key: "new", NotBefore: past, NotAfter: future},
+			}},
+			setAuth:        func(r *http.Request) { r.Header.Set(defaultAPIKeyHeader, "old") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := NewAuthentication(&Config{Tenants: []Tenant{tc.tenant}})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest("GET", "http://localhost", nil)
+			tc.setAuth(req)
+			rr := httptest.NewRecorder()
+			auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "orgid", r.Header.Get("X-Scope-OrgID"))
+			})).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name   string
+		tenant Tenant
+	}{
+		{
+			name: "password and password_hash",
+			tenant: Tenant{Authentication: "basic", Credentials: []Credential{
+				{Username: "user", Password: "secret", PasswordHash: bcryptHash(t, "secret")},
+			}},
+		},
+		{
+			name:   "basic credential without a password",
+			tenant: Tenant{Authentication: "basic", Credentials: []Credential{{Username: "foo"}}},
+		},
+		{
+			name:   "basic credential without a username",
+			tenant: Tenant{Authentication: "basic", Credentials: []Credential{{Password: "secret"}}},
+		},
+		{
+			name:   "top level username without a password",
+			tenant: Tenant{Authentication: "basic", Username: "foo"},
+		},
+		{
+			name:   "top level password without a username",
+			tenant: Tenant{Authentication: "basic", Password: "secret"},
+		},
+		{
+			name: "unsupported password_hash",
+			tenant: Tenant{Authentication: "basic", Credentials: []Credential{
+				{Username: "user", PasswordHash: "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="},
+			}},
+		},
+		{
+			name:   "bearer credential without a token",
+			tenant: Tenant{Authentication: "bearer", Credentials: []Credential{{Key: "key"}}},
+		},
+		{
+			name:   "api_key credential without a key",
+			tenant: Tenant{Authentication: "api_key", Credentials: []Credential{{Token: "token"}}},
+		},
+		{
+			name: "not_after before not_before",
+			tenant: Tenant{Authentication: "bearer", Credentials: []Credential{
+				{Token: "token", NotBefore: now, NotAfter: now.Add(-time.Hour)},
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAuthentication(&Config{Tenants: []Tenant{tc.tenant}})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCredentialsConfig(t *testing.T) {
+	config, err := Init("testdata/credentials.yaml")
+	require.NoError(t, err)
+	require.Len(t, config.Tenants, 1)
+
+	credentials := config.Tenants[0].Credentials
+	require.Len(t, credentials, 2)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), credentials[0].NotAfter.UTC())
+	assert.True(t, credentials[0].NotBefore.IsZero())
+	assert.Equal(t, time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), credentials[1].NotBefore.UTC())
+
+	_, err = NewAuthentication(&config)
+	require.NoError(t, err)
+	assert.Equal(t, "expired at 2024-01-01T00:00:00Z", credentials[0].validAt(time.Now()))
+	assert.Empty(t, credentials[1].validAt(time.Now()))
+}
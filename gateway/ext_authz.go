@@ -0,0 +1,165 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultExtAuthzTimeout        = 5 * time.Second
+	defaultExtAuthzTenantIDHeader = "X-Scope-OrgID"
+	extAuthzCacheMaxEntries       = 10000
+	failOpen                      = "open"
+	failClosed                    = "closed"
+)
+
+type extAuthzDecision struct {
+	allowed bool
+	orgID   string
+	headers http.Header
+}
+
+type extAuthzClient struct {
+	config ExtAuthzConfig
+	client *http.Client
+	cache  *ttlCache[extAuthzDecision]
+}
+
+func newExtAuthzClient(config ExtAuthzConfig) (*extAuthzClient, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("ext_authz authentication requires a url")
+	}
+	switch config.FailureMode {
+	case "":
+		config.FailureMode = failClosed
+	case failOpen, failClosed:
+	default:
+		return nil, fmt.Errorf("invalid ext_authz failure_mode %q, valid options: %s, %s", config.FailureMode, failOpen, failClosed)
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultExtAuthzTimeout
+	}
+	if config.TenantIDHeader == "" {
+		config.TenantIDHeader = defaultExtAuthzTenantIDHeader
+	}
+
+	return &extAuthzClient{
+		config: config,
+		client: &http.Client{},
+		cache:  newTTLCache[extAuthzDecision](extAuthzCacheMaxEntries),
+	}, nil
+}
+
+// check asks the authorization service about the request. An error means no
+// decision could be made, in which case the failure mode applies.
+func (c *extAuthzClient) check(r *http.Request) (extAuthzDecision, error) {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = ""
+	}
+	// every header sent to the service is part of the key, a decision based
+	// on the client address or host must not be replayed for other clients
+	key := newCacheKey(r.Method, r.URL.Path, r.Host, clientIP, r.Header.Get("Authorization"))
+	if c.config.CacheTTL > 0 {
+		if decision, ok := c.cache.get(key); ok {
+			return decision, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), c.config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.URL, nil)
+	if err != nil {
+		return extAuthzDecision{}, err
+	}
+	req.Header.Set("X-Forwarded-Method", r.Method)
+	req.Header.Set("X-Forwarded-Uri", r.URL.Path)
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	if clientIP != "" {
+		req.Header.Set("X-Forwarded-For", clientIP)
+	}
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return extAuthzDecision{}, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	var decision extAuthzDecision
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		decision = extAuthzDecision{
+			allowed: true,
+			orgID:   resp.Header.Get(c.config.TenantIDHeader),
+			headers: http.Header{},
+		}
+		for _, name := range c.config.ResponseHeaders {
+			if values := resp.Header.Values(name); len(values) > 0 {
+				decision.headers[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		decision = extAuthzDecision{allowed: false}
+	default:
+		return extAuthzDecision{}, fmt.Errorf("unexpected status code %d from the authorization service", resp.StatusCode)
+	}
+
+	if c.config.CacheTTL > 0 {
+		c.cache.set(key, decision, time.Now().Add(c.config.CacheTTL))
+	}
+	return decision, nil
+}
+
+// extAuthzAuth reports whether the authorization service allowed the request.
+// failedOpen is set when the service could not be reached and the tenant fails
+// open, the request may then only be accepted once no other tenant accepted it.
+func (tenant *Tenant) extAuthzAuth(w http.ResponseWriter, r *http.Request) (ok, failedOpen bool) {
+	if tenant.extAuthz == nil {
+		return false, false
+	}
+
+	decision, err := tenant.extAuthz.check(r)
+	if err != nil {
+		if tenant.extAuthz.config.FailureMode == failOpen && (tenant.ID != "" || tenant.Passthrough) {
+			logrus.Warnf("authorization service unavailable, failing open: %v", err)
+			return false, true
+		}
+		logrus.Errorf("authorization service unavailable, denying the request: %v", err)
+		return false, false
+	}
+	if !decision.allowed {
+		return false, false
+	}
+
+	orgID := decision.orgID
+	if orgID != "" {
+		if err := validateTenantID(orgID); err != nil {
+			logrus.Warnf("authorization service response header %q: %v", tenant.extAuthz.config.TenantIDHeader, err)
+			return false, false
+		}
+	} else {
+		orgID = tenant.ID
+	}
+	if orgID == "" && !tenant.Passthrough {
+		logrus.Errorf("the authorization service allowed the request but returned no tenant ID")
+		return false, false
+	}
+
+	for name, values := range decision.headers {
+		r.Header[name] = append([]string(nil), values...)
+	}
+	if !tenant.Passthrough {
+		r.Header.Set("X-Scope-OrgID", orgID)
+	}
+	return true, false
+}
@@ -0,0 +1,277 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockAuthzService(t *testing.T, calls *atomic.Int32, delay time.Duration) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(delay)
+		switch r.Header.Get("Authorization") {
+		case "Bearer team-a":
+			if r.Header.Get("X-Forwarded-Method") == http.MethodDelete {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("X-Scope-OrgID", "team-a")
+			w.Header().Set("X-Entitlement", r.Header.Get("X-Forwarded-Uri"))
+			w.Header().Set("X-Internal", "secret")
+		case "Bearer federated":
+			w.Header().Set("X-Scope-OrgID", "team-a|team-b")
+		case "Bearer no-tenant":
+		case "Bearer broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestExtAuthzAuthentication(t *testing.T) {
+	var calls atomic.Int32
+	service := newMockAuthzService(t, &calls, 0)
+	slowService := newMockAuthzService(t, &calls, 200*time.Millisecond)
+
+	testCases := []struct {
+		name            string
+		tenant          Tenant
+		method          string
+		authHeader      string
+		expectedStatus  int
+		expectedOrgID   string
+		expectedHeaders map[string]string
+	}{
+		{
+			name: "allowed with tenant ID from the service",
+			tenant: Tenant{
+				Authentication: "ext_authz",
+				ExtAuthz:       ExtAuthzConfig{URL: service.URL, ResponseHeaders: []string{"x-entitlement"}},
+			},
+			method:          http.MethodGet,
+			authHeader:      "Bearer team-a",
+			expectedStatus:  http.StatusOK,
+			expectedOrgID:   "team-a",
+			expectedHeaders: map[string]string{"X-Entitlement": "/api/v1/push", "X-Internal": ""},
+		},
+		{
+			name: "allowed with the static tenant ID",
+			tenant: Tenant{
+				Authentication: "ext_authz",
+				ID:             "static",
+				ExtAuthz:       ExtAuthzConfig{URL: service.URL},
+			},
+			method:         http.MethodGet,
+			authHeader:     "Bearer no-tenant",
+			expectedStatus: http.StatusOK,
+			expectedOrgID:  "static",
+		},
+		{
+			name: "tenant ID with the federation separator",
+			tenant: Tenant{
+				Authentication: "ext_authz",
+				ID:             "static",
+				ExtAuthz:       ExtAuthzConfig{URL: service.URL},
+			},
+			method:         http.MethodGet,
+			authHeader:     "Bearer federated",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "allowed without any tenant ID",
+			tenant: Tenant{
+				Authentication: "ext_authz",
+				ExtAuthz:       ExtAuthzConfig{URL: service.URL},
+			},
+			method:         http.MethodGet,
+			authHeader:     "Bearer no-tenant",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "forbidden",
+			tenant: Tenant{
+				Authentication: "ext_authz",
+				ExtAuthz:       ExtAuthzConfig{URL: service.URL},
+			},
+			method:         http.MethodDelete,
+			authHeader:     "Bearer team-a",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "unauthorized",
+			tenant: Tenant{
+				Authentication: "ext_authz",
+				ExtAuthz:       ExtAuthzConfig{URL: service.URL},
+			},
+			method:         http.MethodGet,
+			authHeader:     "Bearer unknown",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "service error with fail closed",
+			tenant: Tenant{
+				Authentication: "ext_authz",
+				ID:             "static",
+				ExtAuthz:       ExtAuthzConfig{URL: service.URL},
+			},
+			method:         http.MethodGet,
+			authHeader:     "Bearer broken",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "service error with fail open",
+			tenant: Tenant{
+				Authentication: "ext_authz",
+				ID:             "static",
+				ExtAuthz:       ExtAuthzConfig{URL: service.URL, FailureMode: "open"},
+			},
+			method:         http.MethodGet,
+			authHeader:     "Bearer broken",
+			expectedStatus: http.StatusOK,
+			expectedOrgID:  "static",
+		},
+		{
+			name: "service timeout with fail closed",
+			tenant: Tenant{
+				Authentication: "ext_authz",
+				ExtAuthz:       ExtAuthzConfig{URL: slowService.URL, Timeout: 20 * time.Millisecond},
+			},
+			method:         http.MethodGet,
+			authHeader:     "Bearer team-a",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "service timeout with fail open",
+			tenant: Tenant{
+				Authentication: "ext_authz",
+				ID:             "static",
+				ExtAuthz:       ExtAuthzConfig{URL: slowService.URL, Timeout: 20 * time.Millisecond, FailureMode: "open"},
+			},
+			method:         http.MethodGet,
+			authHeader:     "Bearer team-a",
+			expectedStatus: http.StatusOK,
+			expectedOrgID:  "static",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := NewAuthentication(&Config{Tenants: []Tenant{tc.tenant}})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(tc.method, "http://localhost/api/v1/push", nil)
+			req.Header.Set("Authorization", tc.authHeader)
+			rw := httptest.NewRecorder()
+
+			var forwarded http.Header
+			auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = r.Header.Clone()
+			})).ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedStatus, rw.Code)
+			if tc.expectedStatus == http.StatusOK {
+				assert.Equal(t, tc.expectedOrgID, forwarded.Get("X-Scope-OrgID"))
+				for name, value := range tc.expectedHeaders {
+					assert.Equal(t, value, forwarded.Get(name))
+				}
+			}
+		})
+	}
+}
+
+func TestExtAuthzFailOpenAfterOtherTenants(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	unavailable.Close()
+
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{Authentication: "ext_authz", ID: "ext", ExtAuthz: ExtAuthzConfig{URL: unavailable.URL, FailureMode: "open"}},
+		{Authentication: "basic", Username: "user", Password: "pass", ID: "team-b"},
+	}})
+	require.NoError(t, err)
+
+	for password, expectedOrgID := range map[string]string{"pass": "team-b", "wrong": "ext"} {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/api/v1/push", nil)
+		req.SetBasicAuth("user", password)
+		rw := httptest.NewRecorder()
+		var orgID string
+		auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			orgID = r.Header.Get("X-Scope-OrgID")
+		})).ServeHTTP(rw, req)
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, expectedOrgID, orgID)
+	}
+}
+
+func TestExtAuthzCache(t *testing.T) {
+	var calls atomic.Int32
+	service := newMockAuthzService(t, &calls, 0)
+
+	client, err := newExtAuthzClient(ExtAuthzConfig{URL: service.URL, CacheTTL: time.Minute})
+	require.NoError(t, err)
+
+	check := func(method, authHeader string) extAuthzDecision {
+		req := httptest.NewRequest(method, "http://localhost/api/v1/push", nil)
+		req.Header.Set("Authorization", authHeader)
+		decision, err := client.check(req)
+		require.NoError(t, err)
+		return decision
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, check(http.MethodGet, "Bearer team-a").allowed)
+		assert.False(t, check(http.MethodGet, "Bearer unknown").allowed)
+	}
+	assert.Equal(t, int32(2), calls.Load(), "allow and deny decisions are both cached")
+
+	assert.False(t, check(http.MethodDelete, "Bearer team-a").allowed)
+	assert.Equal(t, int32(3), calls.Load(), "the method is part of the cache key")
+
+	// the forwarded client address and host are part of the key as well
+	for _, target := range []struct{ remoteAddr, host string }{
+		{"10.0.0.1:1234", "localhost"},
+		{"10.0.0.1:5678", "localhost"},
+		{"10.0.0.1:1234", "cortex.example.com"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/api/v1/push", nil)
+		req.RemoteAddr = target.remoteAddr
+		req.Host = target.host
+		req.Header.Set("Authorization", "Bearer team-a")
+		decision, err := client.check(req)
+		require.NoError(t, err)
+		assert.True(t, decision.allowed)
+	}
+	assert.Equal(t, int32(5), calls.Load(), "the client port is not part of the cache key")
+
+	// errors are not cached
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/api/v1/push", nil)
+	req.Header.Set("Authorization", "Bearer broken")
+	for i := 0; i < 2; i++ {
+		_, err := client.check(req)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int32(7), calls.Load())
+}
+
+func TestNewExtAuthzClient(t *testing.T) {
+	_, err := newExtAuthzClient(ExtAuthzConfig{})
+	assert.Error(t, err)
+
+	_, err = newExtAuthzClient(ExtAuthzConfig{URL: "http://localhost", FailureMode: "sometimes"})
+	assert.Error(t, err)
+
+	client, err := newExtAuthzClient(ExtAuthzConfig{URL: "http://localhost"})
+	require.NoError(t, err)
+	assert.Equal(t, failClosed, client.config.FailureMode)
+	assert.Equal(t, defaultExtAuthzTimeout, client.config.Timeout)
+	assert.Equal(t, defaultExtAuthzTenantIDHeader, client.config.TenantIDHeader)
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// tenantIDSeparator joins the tenant IDs of a federated query, see
+// https://cortexmetrics.io/docs/proposals/tenant-federation/
+const tenantIDSeparator = "|"
+
+func (tenant *Tenant) validateReadTenantIDs(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if tenant.Passthrough {
+		return fmt.Errorf("read_tenant_ids cannot be combined with passthrough")
+	}
+	for _, id := range ids {
+		if err := validateTenantID(id); err != nil {
+			return fmt.Errorf("invalid read tenant ID: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateTenantID rejects tenant IDs Cortex would read as several tenants.
+// IDs taken from tokens must pass it, otherwise a token could grant itself a
+// federated query.
+func validateTenantID(id string) error {
+	if id == "" {
+		return fmt.Errorf("the tenant ID is empty")
+	}
+	if strings.Contains(id, tenantIDSeparator) {
+		return fmt.Errorf("the tenant ID %q contains %q", id, tenantIDSeparator)
+	}
+	return nil
+}
+
+// readTenantIDs returns the tenant IDs the identity queries, falling back
+// from the credential to the tenant.
+func (id identity) readTenantIDs() []string {
+	if id.credential != nil && len(id.credential.ReadTenantIDs) > 0 {
+		return id.credential.ReadTenantIDs
+	}
+	return id.tenant.ReadTenantIDs
+}
+
+// federate replaces the single tenant ID set during authentication with the
+// pipe separated read tenant IDs, which Cortex queries together when tenant
+// federation is enabled. It is only used in front of the query frontend, so
+// writes always go to a single tenant.
+func federate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := identityFrom(r.Context()); ok {
+			if ids := id.readTenantIDs(); len(ids) > 0 {
+				r.Header.Set("X-Scope-OrgID", strings.Join(ids, tenantIDSeparator))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
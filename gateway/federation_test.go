@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFederation(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication: "basic",
+			ID:             "sre",
+			Credentials: []Credential{
+				{Username: "grafana", Password: "grafana", ReadTenantIDs: []string{"team-a", "team-b", "team-c"}},
+				{Username: "prometheus", Password: "prometheus"},
+			},
+		},
+		{Authentication: "bearer", Token: "token", ID: "team-a", ReadTenantIDs: []string{"team-a", "shared"}},
+	}})
+	require.NoError(t, err)
+
+	var orgID string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgID = r.Header.Get("X-Scope-OrgID")
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/push", authorize(DISTRIBUTOR, upstream))
+	mux.Handle("/prometheus/api/v1/query", authorize(FRONTEND, federate(upstream)))
+	mux.Handle("/prometheus/api/v1/rules", authorize(RULER, upstream))
+	handler := auth.Wrap(mux)
+
+	testCases := []struct {
+		name          string
+		path          string
+		setAuth       func(r *http.Request)
+		expectedOrgID string
+	}{
+		{
+			name:          "credential read tenant IDs on a read path",
+			path:          "/prometheus/api/v1/query",
+			setAuth:       func(r *http.Request) { r.SetBasicAuth("grafana", "grafana") },
+			expectedOrgID: "team-a|team-b|team-c",
+		},
+		{
+			name:          "credential read tenant IDs on a write path",
+			path:          "/api/v1/push",
+			setAuth:       func(r *http.Request) { r.SetBasicAuth("grafana", "grafana") },
+			expectedOrgID: "sre",
+		},
+		{
+			name:          "credential read tenant IDs on the ruler",
+			path:          "/prometheus/api/v1/rules",
+			setAuth:       func(r *http.Request) { r.SetBasicAuth("grafana", "grafana") },
+			expectedOrgID: "sre",
+		},
+		{
+			name:          "credential without read tenant IDs",
+			path:          "/prometheus/api/v1/query",
+			setAuth:       func(r *http.Request) { r.SetBasicAuth("prometheus", "prometheus") },
+			expectedOrgID: "sre",
+		},
+		{
+			name:          "tenant read tenant IDs",
+			path:          "/prometheus/api/v1/query",
+			setAuth:       func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") },
+			expectedOrgID: "team-a|shared",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			orgID = ""
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			tc.setAuth(req)
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, http.StatusOK, rw.Code)
+			assert.Equal(t, tc.expectedOrgID, orgID)
+		})
+	}
+}
+
+func TestInvalidReadTenantIDs(t *testing.T) {
+	testCases := []struct {
+		name   string
+		tenant Tenant
+	}{
+		{
+			name:   "empty tenant ID",
+			tenant: Tenant{Authentication: "mtls", ReadTenantIDs: []string{"a", ""}},
+		},
+		{
+			name:   "tenant ID with the separator",
+			tenant: Tenant{Authentication: "bearer", Credentials: []Credential{{Token: "token", ReadTenantIDs: []string{"a|b"}}}},
+		},
+		{
+			name:   "passthrough tenant",
+			tenant: Tenant{Authentication: "bearer", Token: "token", Passthrough: true, ReadTenantIDs: []string{"a", "b"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAuthentication(&Config{Tenants: []Tenant{tc.tenant}})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package gateway
 import (
 	"net/http"
 
+	"github.com/cortexproject/auth-gateway/middleware"
 	"github.com/cortexproject/auth-gateway/server"
 	"github.com/sirupsen/logrus"
 )
@@ -12,6 +13,10 @@ type Gateway struct {
 	queryFrontendProxy *Proxy
 	alertmanagerProxy  *Proxy
 	rulerProxy         *Proxy
+	ingestionLimiter   *IngestionLimiter
+	remoteWrite        *RemoteWriteInspector
+	queryCache         *ResponseCache
+	coalescer          *Coalescer
 	srv                *server.Server
 }
 
@@ -59,8 +64,18 @@ var defaultRulerAPIs = []string{
 }
 
 func New(config *Config, srv *server.Server) (*Gateway, error) {
+	queryCache, err := NewResponseCache(config.QueryCache, srv.Registerer())
+	if err != nil {
+		return nil, err
+	}
 	gateway := &Gateway{
-		srv: srv,
+		ingestionLimiter: NewIngestionLimiter(srv.Registerer()),
+		remoteWrite:      NewRemoteWriteInspector(srv.Registerer()),
+		queryCache:       queryCache,
+		srv:              srv,
+	}
+	if config.CoalesceQueries {
+		gateway.coalescer = NewCoalescer(srv.Registerer())
 	}
 
 	components := []string{DISTRIBUTOR, FRONTEND, ALERTMANAGER, RULER}
@@ -119,13 +134,45 @@ func setupProxy(upstreamConfig Upstream, proxyType string, description string) (
 }
 
 func (g *Gateway) registerRoutes(config *Config) {
-	g.registerProxyRoutes(config.Distributor.Paths, defaultDistributorAPIs, http.HandlerFunc(g.distributorProxy.Handler))
-	g.registerProxyRoutes(config.QueryFrontend.Paths, defaultQueryFrontendAPIs, http.HandlerFunc(g.queryFrontendProxy.Handler))
-	g.registerProxyRoutes(config.Alertmanager.Paths, defaultAlertmanagerAPIs, http.HandlerFunc(g.alertmanagerProxy.Handler))
-	g.registerProxyRoutes(config.Ruler.Paths, defaultRulerAPIs, http.HandlerFunc(g.rulerProxy.Handler))
+	g.registerProxyRoutes(config.Distributor.Paths, defaultDistributorAPIs, componentMiddleware(DISTRIBUTOR, g.ingestionLimiter, g.remoteWrite).Wrap(http.HandlerFunc(g.distributorProxy.Handler)))
+	g.registerProxyRoutes(config.QueryFrontend.Paths, defaultQueryFrontendAPIs, componentMiddleware(FRONTEND, g.queryFrontendMiddlewares()...).Wrap(http.HandlerFunc(g.queryFrontendProxy.Handler)))
+	g.registerProxyRoutes(config.Alertmanager.Paths, defaultAlertmanagerAPIs, componentMiddleware(ALERTMANAGER).Wrap(http.HandlerFunc(g.alertmanagerProxy.Handler)))
+	g.registerProxyRoutes(config.Ruler.Paths, defaultRulerAPIs, componentMiddleware(RULER).Wrap(http.HandlerFunc(g.rulerProxy.Handler)))
 	g.srv.RegisterTo("/", http.HandlerFunc(g.notFoundHandler), server.UNAUTH)
 }
 
+// componentMiddleware returns the middlewares that run between the
+// authentication and the proxy of a component.
+func componentMiddleware(component string, extra ...middleware.Interface) middleware.Interface {
+	middlewares := []middleware.Interface{
+		middleware.Adapter(func(next http.Handler) http.Handler {
+			return authorize(component, next)
+		}),
+		NewRateLimiter(component),
+	}
+	return middleware.Merge(append(middlewares, extra...)...)
+}
+
+// queryFrontendMiddlewares check and rewrite queries before they are looked
+// up in the cache, so that its key is what would be forwarded.
+func (g *Gateway) queryFrontendMiddlewares() []middleware.Interface {
+	middlewares := []middleware.Interface{
+		middleware.Adapter(limitQueries),
+		middleware.Adapter(checkQueryPolicy),
+		middleware.Adapter(enforceLabels),
+		NewConcurrencyLimiter(),
+		middleware.Adapter(federate),
+	}
+	if g.queryCache != nil {
+		middlewares = append(middlewares, g.queryCache)
+	}
+	// behind the cache, so that concurrent misses are coalesced
+	if g.coalescer != nil {
+		middlewares = append(middlewares, g.coalescer)
+	}
+	return middlewares
+}
+
 func (g *Gateway) registerProxyRoutes(paths []string, defaultPaths []string, handler http.Handler) {
 	pathsToRegister := defaultPaths
 	if len(paths) > 0 {
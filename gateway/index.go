@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"net/http"
+	"sort"
+)
+
+type apiKeySource struct {
+	header     string
+	queryParam string
+}
+
+// credentialIndex narrows a request down to the tenants that can possibly
+// accept it, so that a request does not have to be checked against every
+// tenant. Usernames are indexed as is, bearer tokens and API keys by their
+// hash. The candidates still verify the secret in constant time.
+type credentialIndex struct {
+	usernames     map[string][]int
+	tokens        map[cacheKey][]int
+	apiKeys       map[cacheKey][]int
+	apiKeySources []apiKeySource
+	// tenants whose authentication method cannot be indexed
+	unindexed []int
+	// tenants that send the request to an external service, they are tried
+	// last so that the credentials of other tenants never leave the gateway
+	external []int
+}
+
+func newCredentialIndex(tenants []Tenant) *credentialIndex {
+	index := &credentialIndex{
+		usernames: map[string][]int{},
+		tokens:    map[cacheKey][]int{},
+		apiKeys:   map[cacheKey][]int{},
+	}
+	sources := map[apiKeySource]bool{}
+
+	for i := range tenants {
+		tenant := &tenants[i]
+		switch tenant.Authentication {
+		case "basic":
+			for _, credential := range tenant.credentials {
+				index.usernames[credential.Username] = appendTenant(index.usernames[credential.Username], i)
+			}
+		case "bearer":
+			for _, credential := range tenant.credentials {
+				key := newCacheKey(credential.Token)
+				index.tokens[key] = appendTenant(index.tokens[key], i)
+			}
+		case "api_key":
+			for _, credential := range tenant.credentials {
+				key := newCacheKey(credential.Key)
+				index.apiKeys[key] = appendTenant(index.apiKeys[key], i)
+			}
+			source := apiKeySource{header: tenant.APIKey.header(), queryParam: tenant.APIKey.QueryParam}
+			if !sources[source] {
+				sources[source] = true
+				index.apiKeySources = append(index.apiKeySources, source)
+			}
+		case "ext_authz", "introspection":
+			index.external = append(index.external, i)
+		default:
+			index.unindexed = append(index.unindexed, i)
+		}
+	}
+
+	return index
+}
+
+// appendTenant adds a tenant once, even when several of its credentials share
+// the same identifier.
+func appendTenant(tenants []int, i int) []int {
+	if len(tenants) > 0 && tenants[len(tenants)-1] == i {
+		return tenants
+	}
+	return append(tenants, i)
+}
+
+// candidates returns the indexes of the tenants to try for the request, in the
+// order they are configured, followed by the tenants using an external service.
+func (index *credentialIndex) candidates(r *http.Request) []int {
+	var candidates []int
+	if username, _, ok := r.BasicAuth(); ok {
+		candidates = append(candidates, index.usernames[username]...)
+	}
+	if token, ok := bearerToken(r); ok {
+		candidates = append(candidates, index.tokens[newCacheKey(token)]...)
+	}
+
+	var query map[string][]string
+	for _, source := range index.apiKeySources {
+		if source.header != "" {
+			if key := r.Header.Get(source.header); key != "" {
+				candidates = append(candidates, index.apiKeys[newCacheKey(key)]...)
+			}
+		}
+		if source.queryParam != "" {
+			if query == nil {
+				query = r.URL.Query()
+			}
+			if values := query[source.queryParam]; len(values) > 0 && values[0] != "" {
+				candidates = append(candidates, index.apiKeys[newCacheKey(values[0])]...)
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		candidates = append(candidates, index.unindexed...)
+		return append(candidates, index.external...)
+	}
+	candidates = append(candidates, index.unindexed...)
+	sort.Ints(candidates)
+
+	// the same tenant can be found through several API key sources
+	unique := candidates[:1]
+	for _, i := range candidates[1:] {
+		if i != unique[len(unique)-1] {
+			unique = append(unique, i)
+		}
+	}
+	return append(unique, index.external...)
+}
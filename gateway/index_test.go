@@ -0,0 +1,124 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialIndexCandidates(t *testing.T) {
+	tenants := []Tenant{
+		{Authentication: "basic", Username: "alice", Password: "a", ID: "0"},
+		{Authentication: "bearer", Token: "token", ID: "1"},
+		{Authentication: "mtls", MTLS: MTLSConfig{Fingerprint: "00"}, ID: "2"},
+		{Authentication: "api_key", APIKey: APIKeyConfig{Key: "key", Header: "X-Key", QueryParam: "key"}, ID: "3"},
+		{Authentication: "basic", Username: "alice", Password: "b", Credentials: []Credential{{Username: "alice", Password: "c"}}, ID: "4"},
+		{Authentication: "api_key", APIKey: APIKeyConfig{Key: "key"}, ID: "5"},
+	}
+	_, err := NewAuthentication(&Config{Server: mtlsServer, Tenants: tenants})
+	require.NoError(t, err)
+	index := newCredentialIndex(tenants)
+
+	testCases := []struct {
+		name       string
+		url        string
+		setAuth    func(r *http.Request)
+		candidates []int
+	}{
+		{
+			name:       "no credentials",
+			url:        "http://localhost",
+			setAuth:    func(r *http.Request) {},
+			candidates: []int{2},
+		},
+		{
+			name:       "username shared by two tenants",
+			url:        "http://localhost",
+			setAuth:    func(r *http.Request) { r.SetBasicAuth("alice", "wrong") },
+			candidates: []int{0, 2, 4},
+		},
+		{
+			name:       "unknown username",
+			url:        "http://localhost",
+			setAuth:    func(r *http.Request) { r.SetBasicAuth("bob", "a") },
+			candidates: []int{2},
+		},
+		{
+			name:       "bearer token",
+			url:        "http://localhost",
+			setAuth:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") },
+			candidates: []int{1, 2},
+		},
+		{
+			name:       "unknown bearer token",
+			url:        "http://localhost",
+			setAuth:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer other") },
+			candidates: []int{2},
+		},
+		{
+			name: "api key found through several sources",
+			url:  "http://localhost?key=key",
+			setAuth: func(r *http.Request) {
+				r.Header.Set("X-Key", "key")
+				r.Header.Set(defaultAPIKeyHeader, "key")
+			},
+			candidates: []int{2, 3, 5},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.url, nil)
+			tc.setAuth(req)
+			assert.Equal(t, tc.candidates, index.candidates(req))
+		})
+	}
+}
+
+func TestCredentialIndexTriesExternalTenantsLast(t *testing.T) {
+	tenants := []Tenant{
+		{Authentication: "ext_authz", ExtAuthz: ExtAuthzConfig{URL: "http://localhost"}, ID: "0"},
+		{Authentication: "bearer", Token: "token", ID: "1"},
+		{Authentication: "mtls", MTLS: MTLSConfig{Fingerprint: "00"}, ID: "2"},
+		{Authentication: "introspection", Introspection: IntrospectionConfig{URL: "http://localhost", ClientID: "gateway", ClientSecret: "secret"}, ID: "3"},
+		{Authentication: "basic", Username: "alice", Password: "a", ID: "4"},
+	}
+	_, err := NewAuthentication(&Config{Server: mtlsServer, Tenants: tenants})
+	require.NoError(t, err)
+	index := newCredentialIndex(tenants)
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	assert.Equal(t, []int{2, 0, 3}, index.candidates(req))
+
+	req.Header.Set("Authorization", "Bearer token")
+	assert.Equal(t, []int{1, 2, 0, 3}, index.candidates(req))
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.SetBasicAuth("alice", "a")
+	assert.Equal(t, []int{2, 4, 0, 3}, index.candidates(req))
+}
+
+func TestCredentialIndexKeepsTenantOrder(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{Authentication: "basic", Username: "user", Password: "first", ID: "orgid1"},
+		{Authentication: "basic", Username: "user", Password: "second", ID: "orgid2"},
+		{Authentication: "basic", Username: "user", Password: "first", ID: "orgid3"},
+	}})
+	require.NoError(t, err)
+
+	for password, expectedOrgID := range map[string]string{"first": "orgid1", "second": "orgid2"} {
+		req := httptest.NewRequest("GET", "http://localhost", nil)
+		req.SetBasicAuth("user", password)
+		rw := httptest.NewRecorder()
+		var orgID string
+		auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			orgID = r.Header.Get("X-Scope-OrgID")
+		})).ServeHTTP(rw, req)
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, expectedOrgID, orgID)
+	}
+}
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	reasonBodyTooLarge = "body_too_large"
+	reasonByteRate     = "byte_rate_limited"
+)
+
+func (l IngestionLimits) validate() error {
+	if l.MaxBodySize < 0 || l.BytesPerSecond < 0 || l.BurstBytes < 0 {
+		return fmt.Errorf("ingestion limits must not be negative")
+	}
+	if l.BurstBytes > 0 && l.BytesPerSecond == 0 {
+		return fmt.Errorf("ingestion limit burst_bytes requires bytes_per_second")
+	}
+	if l.BurstBytes > 0 && l.MaxBodySize > l.BurstBytes {
+		return fmt.Errorf("ingestion limit burst_bytes must not be smaller than max_body_size")
+	}
+	return nil
+}
+
+func (l IngestionLimits) enabled() bool {
+	return l.MaxBodySize > 0 || l.BytesPerSecond > 0
+}
+
+// burst defaults to one second worth of bytes, or the maximum body size if
+// that is larger, so that every accepted body fits into the bucket.
+func (l IngestionLimits) burst() float64 {
+	if l.BurstBytes > 0 {
+		return float64(l.BurstBytes)
+	}
+	return math.Max(l.BytesPerSecond, float64(l.MaxBodySize))
+}
+
+// maxSize returns the largest body accepted, which is at most the burst when
+// there is a byte rate, since a larger body could never be let through.
+func (l IngestionLimits) maxSize() int64 {
+	maxSize := l.MaxBodySize
+	if l.BytesPerSecond > 0 {
+		if burst := int64(l.burst()); maxSize == 0 || burst < maxSize {
+			maxSize = burst
+		}
+	}
+	return maxSize
+}
+
+// IngestionLimiter enforces the body size and byte rate limits of the
+// authenticated tenant on pushes. The body is read before it is forwarded, so
+// that its size is known, and the byte budget is keyed by the identity's
+// limitKey.
+type IngestionLimiter struct {
+	buckets          *tokenBuckets
+	rejectedBytes    *prometheus.CounterVec
+	rejectedRequests *prometheus.CounterVec
+}
+
+func NewIngestionLimiter(reg prometheus.Registerer) *IngestionLimiter {
+	return &IngestionLimiter{
+		buckets: newTokenBuckets(),
+		rejectedBytes: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "gateway_push_rejected_bytes_total",
+			Help:      "Bytes of push requests rejected because of the tenant's ingestion limits.",
+		}, []string{"tenant", "reason"}),
+		rejectedRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "gateway_push_rejected_requests_total",
+			Help:      "Push requests rejected because of the tenant's ingestion limits.",
+		}, []string{"tenant", "reason"}),
+	}
+}
+
+func (l *IngestionLimiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := identityFrom(r.Context())
+		if !ok || !id.tenant.IngestionLimits.enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limits := id.tenant.IngestionLimits
+		orgID := r.Header.Get("X-Scope-OrgID")
+
+		maxSize := limits.maxSize()
+		// a known length too large is rejected without reading the body
+		if r.ContentLength > maxSize {
+			l.reject(w, orgID, reasonBodyTooLarge, r.ContentLength, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+		if err != nil {
+			logrus.Debugf("reading the push request body of tenant %s: %v", orgID, err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		size := int64(len(body))
+		if size > maxSize {
+			l.reject(w, orgID, reasonBodyTooLarge, size, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if limits.BytesPerSecond > 0 {
+			if allowed, retryAfter := l.buckets.take(id.limitKey(r), limits.BytesPerSecond, limits.burst(), float64(size)); !allowed {
+				w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+				l.reject(w, orgID, reasonByteRate, size, http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = size
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *IngestionLimiter) reject(w http.ResponseWriter, orgID, reason string, size int64, status int) {
+	logrus.Debugf("rejecting a push request of %d bytes from tenant %s: %s", size, orgID, reason)
+	l.rejectedBytes.WithLabelValues(orgID, reason).Add(float64(size))
+	l.rejectedRequests.WithLabelValues(orgID, reason).Inc()
+	http.Error(w, http.StatusText(status), status)
+}
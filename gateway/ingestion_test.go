@@ -0,0 +1,163 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestionLimiter(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication:  "bearer",
+			Token:           "limited",
+			ID:              "limited",
+			IngestionLimits: IngestionLimits{MaxBodySize: 100, BytesPerSecond: 10, BurstBytes: 150},
+		},
+		{Authentication: "bearer", Token: "unlimited", ID: "unlimited"},
+	}})
+	require.NoError(t, err)
+
+	limiter := NewIngestionLimiter(prometheus.NewRegistry())
+	var forwarded []byte
+	handler := auth.Wrap(limiter.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded, _ = io.ReadAll(r.Body)
+		assert.Equal(t, int64(len(forwarded)), r.ContentLength)
+	})))
+
+	push := func(token string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "http://localhost/api/v1/push", body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := push("limited", bytes.NewReader(make([]byte, 100)))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Len(t, forwarded, 100)
+
+	// a known Content-Length is rejected up front
+	forwarded = nil
+	assert.Equal(t, http.StatusRequestEntityTooLarge, push("limited", bytes.NewReader(make([]byte, 101))).Code)
+	assert.Nil(t, forwarded)
+
+	// so is a body of unknown length once it grows too large
+	assert.Equal(t, http.StatusRequestEntityTooLarge, push("limited", io.MultiReader(bytes.NewReader(make([]byte, 500)))).Code)
+
+	// 50 bytes are left in the bucket
+	assert.Equal(t, http.StatusOK, push("limited", bytes.NewReader(make([]byte, 50))).Code)
+	rw = push("limited", bytes.NewReader(make([]byte, 30)))
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	assert.Equal(t, "3", rw.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, push("unlimited", bytes.NewReader(make([]byte, 1000))).Code)
+
+	assert.Equal(t, 101.0+101.0, testutil.ToFloat64(limiter.rejectedBytes.WithLabelValues("limited", reasonBodyTooLarge)))
+	assert.Equal(t, 30.0, testutil.ToFloat64(limiter.rejectedBytes.WithLabelValues("limited", reasonByteRate)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(limiter.rejectedRequests.WithLabelValues("limited", reasonBodyTooLarge)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(limiter.rejectedRequests.WithLabelValues("limited", reasonByteRate)))
+}
+
+func TestIngestionLimiterPassthrough(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication:  "bearer",
+			Token:           "passthrough",
+			Passthrough:     true,
+			IngestionLimits: IngestionLimits{BytesPerSecond: 10, BurstBytes: 100},
+		},
+	}})
+	require.NoError(t, err)
+	handler := auth.Wrap(NewIngestionLimiter(prometheus.NewRegistry()).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	push := func(orgID string) int {
+		req := httptest.NewRequest("POST", "http://localhost/api/v1/push", bytes.NewReader(make([]byte, 60)))
+		req.Header.Set("Authorization", "Bearer passthrough")
+		req.Header.Set("X-Scope-OrgID", orgID)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	// the byte budget is shared by every org ID the tenant sends
+	assert.Equal(t, http.StatusOK, push("team-1"))
+	assert.Equal(t, http.StatusTooManyRequests, push("team-2"))
+}
+
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += n
+	return n, err
+}
+
+func TestIngestionLimiterReadsAtMostBurst(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{Authentication: "bearer", Token: "token", ID: "tenant", IngestionLimits: IngestionLimits{BytesPerSecond: 100}},
+	}})
+	require.NoError(t, err)
+	handler := auth.Wrap(NewIngestionLimiter(prometheus.NewRegistry()).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	// a chunked body of unknown length is not buffered beyond the burst
+	body := &countingReader{Reader: bytes.NewReader(make([]byte, 1<<20))}
+	req := httptest.NewRequest("POST", "http://localhost/api/v1/push", io.MultiReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+	assert.LessOrEqual(t, body.read, 101)
+}
+
+func TestIngestionLimitsMaxSize(t *testing.T) {
+	assert.Equal(t, int64(100), IngestionLimits{BytesPerSecond: 100}.maxSize())
+	assert.Equal(t, int64(50), IngestionLimits{MaxBodySize: 50}.maxSize())
+	assert.Equal(t, int64(50), IngestionLimits{BytesPerSecond: 100, MaxBodySize: 50, BurstBytes: 500}.maxSize())
+	assert.Equal(t, int64(20), IngestionLimits{BytesPerSecond: 100, MaxBodySize: 50, BurstBytes: 20}.maxSize())
+}
+
+func TestIngestionLimitsBurst(t *testing.T) {
+	assert.Equal(t, 500.0, IngestionLimits{BytesPerSecond: 100, BurstBytes: 500}.burst())
+	assert.Equal(t, 100.0, IngestionLimits{BytesPerSecond: 100}.burst())
+	assert.Equal(t, 1000.0, IngestionLimits{BytesPerSecond: 100, MaxBodySize: 1000}.burst())
+}
+
+func TestInvalidIngestionLimits(t *testing.T) {
+	testCases := []struct {
+		name   string
+		limits IngestionLimits
+	}{
+		{
+			name:   "negative max_body_size",
+			limits: IngestionLimits{MaxBodySize: -1},
+		},
+		{
+			name:   "burst_bytes without bytes_per_second",
+			limits: IngestionLimits{BurstBytes: 100},
+		},
+		{
+			name:   "burst_bytes smaller than max_body_size",
+			limits: IngestionLimits{MaxBodySize: 100, BytesPerSecond: 10, BurstBytes: 50},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAuthentication(&Config{Tenants: []Tenant{
+				{Authentication: "bearer", Token: "token", ID: "orgid", IngestionLimits: tc.limits},
+			}})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultIntrospectionTimeout     = 5 * time.Second
+	defaultIntrospectionMaxCacheTTL = 5 * time.Minute
+	introspectionCacheMaxEntries    = 10000
+	// limits how much of an introspection response is read
+	maxIntrospectionResponseSize = 1 << 20
+)
+
+type introspectionClient struct {
+	config IntrospectionConfig
+	client *http.Client
+	cache  *ttlCache[map[string]interface{}]
+}
+
+func newIntrospectionClient(config IntrospectionConfig) (*introspectionClient, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("introspection authentication requires a url")
+	}
+	if config.ClientID == "" {
+		return nil, fmt.Errorf("introspection authentication requires a client_id")
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultIntrospectionTimeout
+	}
+	if config.MaxCacheTTL == 0 {
+		config.MaxCacheTTL = defaultIntrospectionMaxCacheTTL
+	}
+
+	return &introspectionClient{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		cache:  newTTLCache[map[string]interface{}](introspectionCacheMaxEntries),
+	}, nil
+}
+
+// introspect returns the claims of an active token, or nil for a token the
+// authorization server does not consider active. Active results are cached
+// until the token expires, but at most for max_cache_ttl.
+func (c *introspectionClient) introspect(ctx context.Context, token string) (map[string]interface{}, error) {
+	key := newCacheKey(token)
+	if claims, ok := c.cache.get(key); ok {
+		return claims, nil
+	}
+
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from the introspection endpoint", resp.StatusCode)
+	}
+
+	claims := map[string]interface{}{}
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxIntrospectionResponseSize))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("parsing the introspection response: %v", err)
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, nil
+	}
+
+	expiry := time.Now().Add(c.config.MaxCacheTTL)
+	if exp, ok := claims["exp"].(json.Number); ok {
+		seconds, err := exp.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid exp in the introspection response: %v", err)
+		}
+		tokenExpiry := time.Unix(seconds, 0)
+		if !tokenExpiry.After(time.Now()) {
+			return nil, nil
+		}
+		if tokenExpiry.Before(expiry) {
+			expiry = tokenExpiry
+		}
+	}
+	c.cache.set(key, claims, expiry)
+
+	return claims, nil
+}
+
+func (tenant *Tenant) introspectionAuth(w http.ResponseWriter, r *http.Request) bool {
+	if tenant.introspection == nil {
+		return false
+	}
+	token, ok := bearerToken(r)
+	if !ok {
+		return false
+	}
+
+	claims, err := tenant.introspection.introspect(r.Context(), token)
+	if err != nil {
+		logrus.Errorf("token introspection failed: %v", err)
+		return false
+	}
+	if claims == nil {
+		logrus.Debugf("the introspected token is not active")
+		return false
+	}
+
+	orgID := tenant.ID
+	if field := tenant.introspection.config.TenantIDField; field != "" {
+		orgID, _ = claims[field].(string)
+		if orgID == "" {
+			logrus.Debugf("introspection response field %q is missing or is not a string", field)
+			return false
+		}
+		if err := validateTenantID(orgID); err != nil {
+			logrus.Warnf("introspection response field %q: %v", field, err)
+			return false
+		}
+	}
+
+	if !tenant.Passthrough {
+		r.Header.Set("X-Scope-OrgID", orgID)
+	}
+	return true
+}
@@ -0,0 +1,207 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockIntrospectionServer(t *testing.T, calls *atomic.Int32) *httptest.Server {
+	tokens := map[string]map[string]interface{}{
+		"active-token":    {"active": true, "exp": time.Now().Add(time.Hour).Unix(), "org": "team-a"},
+		"no-exp-token":    {"active": true, "org": "team-b"},
+		"no-org-token":    {"active": true, "exp": time.Now().Add(time.Hour).Unix()},
+		"multi-org-token": {"active": true, "exp": time.Now().Add(time.Hour).Unix(), "org": "team-a|team-b"},
+		"expired-token":   {"active": true, "exp": time.Now().Add(-time.Minute).Unix(), "org": "team-a"},
+		"inactive-token":  {"active": false},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "gateway" || clientSecret != "client-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.PostFormValue("token_type_hint") != "access_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		response, ok := tokens[r.PostFormValue("token")]
+		if !ok {
+			response = map[string]interface{}{"active": false}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestIntrospectionAuthentication(t *testing.T) {
+	var calls atomic.Int32
+	server := newMockIntrospectionServer(t, &calls)
+
+	config := IntrospectionConfig{
+		URL:           server.URL,
+		ClientID:      "gateway",
+		ClientSecret:  "client-secret",
+		TenantIDField: "org",
+	}
+
+	testCases := []struct {
+		name           string
+		tenant         Tenant
+		token          string
+		expectedStatus int
+		expectedOrgID  string
+	}{
+		{
+			name:           "active token",
+			tenant:         Tenant{Authentication: "introspection", Introspection: config},
+			token:          "active-token",
+			expectedStatus: http.StatusOK,
+			expectedOrgID:  "team-a",
+		},
+		{
+			name:           "active token with the static tenant ID",
+			tenant:         Tenant{Authentication: "introspection", ID: "static", Introspection: IntrospectionConfig{URL: server.URL, ClientID: "gateway", ClientSecret: "client-secret"}},
+			token:          "no-org-token",
+			expectedStatus: http.StatusOK,
+			expectedOrgID:  "static",
+		},
+		{
+			name:           "active token without the tenant field",
+			tenant:         Tenant{Authentication: "introspection", Introspection: config},
+			token:          "no-org-token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "active token with the separator in the tenant field",
+			tenant:         Tenant{Authentication: "introspection", Introspection: config},
+			token:          "multi-org-token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "inactive token",
+			tenant:         Tenant{Authentication: "introspection", Introspection: config},
+			token:          "inactive-token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown token",
+			tenant:         Tenant{Authentication: "introspection", Introspection: config},
+			token:          "unknown-token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "expired token",
+			tenant:         Tenant{Authentication: "introspection", Introspection: config},
+			token:          "expired-token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong client credentials",
+			tenant:         Tenant{Authentication: "introspection", Introspection: IntrospectionConfig{URL: server.URL, ClientID: "gateway", ClientSecret: "wrong", TenantIDField: "org"}},
+			token:          "active-token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := NewAuthentication(&Config{Tenants: []Tenant{tc.tenant}})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest("GET", "http://localhost", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rw := httptest.NewRecorder()
+
+			var orgID string
+			auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				orgID = r.Header.Get("X-Scope-OrgID")
+			})).ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedStatus, rw.Code)
+			assert.Equal(t, tc.expectedOrgID, orgID)
+		})
+	}
+}
+
+func TestIntrospectionAfterLocalTenants(t *testing.T) {
+	var calls atomic.Int32
+	server := newMockIntrospectionServer(t, &calls)
+
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{Authentication: "introspection", Introspection: IntrospectionConfig{URL: server.URL, ClientID: "gateway", ClientSecret: "client-secret", TenantIDField: "org"}},
+		{Authentication: "bearer", Token: "static-token", ID: "team-b"},
+	}})
+	require.NoError(t, err)
+
+	for token, expectedOrgID := range map[string]string{"static-token": "team-b", "active-token": "team-a"} {
+		req := httptest.NewRequest("GET", "http://localhost", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rw := httptest.NewRecorder()
+		var orgID string
+		auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			orgID = r.Header.Get("X-Scope-OrgID")
+		})).ServeHTTP(rw, req)
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, expectedOrgID, orgID)
+	}
+	assert.Equal(t, int32(1), calls.Load(), "the static bearer token is never sent to the introspection endpoint")
+}
+
+func TestIntrospectionCache(t *testing.T) {
+	var calls atomic.Int32
+	server := newMockIntrospectionServer(t, &calls)
+
+	client, err := newIntrospectionClient(IntrospectionConfig{
+		URL:          server.URL,
+		ClientID:     "gateway",
+		ClientSecret: "client-secret",
+		MaxCacheTTL:  time.Minute,
+	})
+	require.NoError(t, err)
+
+	ctx := httptest.NewRequest("GET", "http://localhost", nil).Context()
+	for i := 0; i < 3; i++ {
+		claims, err := client.introspect(ctx, "active-token")
+		require.NoError(t, err)
+		assert.Equal(t, "team-a", claims["org"])
+	}
+	assert.Equal(t, int32(1), calls.Load(), "active results are cached")
+
+	for i := 0; i < 2; i++ {
+		claims, err := client.introspect(ctx, "inactive-token")
+		require.NoError(t, err)
+		assert.Nil(t, claims)
+	}
+	assert.Equal(t, int32(3), calls.Load(), "inactive results are not cached")
+
+	// the cache entry never outlives max_cache_ttl, even without exp
+	_, err = client.introspect(ctx, "no-exp-token")
+	require.NoError(t, err)
+	entry := client.cache.entries[newCacheKey("no-exp-token")]
+	assert.WithinDuration(t, time.Now().Add(time.Minute), entry.expiry, 5*time.Second)
+}
+
+func TestNewIntrospectionClient(t *testing.T) {
+	_, err := newIntrospectionClient(IntrospectionConfig{ClientID: "gateway"})
+	assert.Error(t, err)
+
+	_, err = newIntrospectionClient(IntrospectionConfig{URL: "http://localhost"})
+	assert.Error(t, err)
+
+	client, err := newIntrospectionClient(IntrospectionConfig{URL: "http://localhost", ClientID: "gateway"})
+	require.NoError(t, err)
+	assert.Equal(t, defaultIntrospectionTimeout, client.config.Timeout)
+	assert.Equal(t, defaultIntrospectionMaxCacheTTL, client.config.MaxCacheTTL)
+}
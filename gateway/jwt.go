@@ -0,0 +1,321 @@
+package gateway
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	supportedJWTAlgorithms = []string{"RS256", "ES256", "HS256"}
+	// a symmetric key fetched from a public JWKS URL is no secret, so OIDC
+	// tokens are only verified with asymmetric keys
+	oidcJWTAlgorithms = []string{"RS256", "ES256"}
+)
+
+type jwtKey struct {
+	id  string
+	key interface{}
+}
+
+// keySet supplies the candidate verification keys for a token's key ID.
+type keySet interface {
+	lookup(kid string) []interface{}
+}
+
+type staticKeySet []jwtKey
+
+func (s staticKeySet) lookup(kid string) []interface{} {
+	var keys []interface{}
+	for _, k := range s {
+		// keys loaded from PEM files carry no ID, so they are always candidates
+		if kid == "" || k.id == "" || k.id == kid {
+			keys = append(keys, k.key)
+		}
+	}
+	return keys
+}
+
+func (s staticKeySet) hasKey(kid string) bool {
+	for _, k := range s {
+		if k.id == kid {
+			return true
+		}
+	}
+	return false
+}
+
+type jwtVerifier struct {
+	keys          keySet
+	parser        *jwt.Parser
+	tenantIDClaim string
+}
+
+func newJWTVerifier(config JWTConfig) (*jwtVerifier, error) {
+	if config.JWKSFile == "" && config.KeyFile == "" {
+		return nil, fmt.Errorf("jwt authentication requires either jwks_file or key_file")
+	}
+
+	var keys staticKeySet
+	if config.JWKSFile != "" {
+		data, err := os.ReadFile(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		jwks, err := parseJWKS(data, true)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", config.JWKSFile, err)
+		}
+		keys = append(keys, jwks...)
+	}
+	if config.KeyFile != "" {
+		data, err := os.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		pemKeys, err := parsePEMKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", config.KeyFile, err)
+		}
+		keys = append(keys, pemKeys...)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable keys found for jwt authentication")
+	}
+
+	return &jwtVerifier{
+		keys:          keys,
+		parser:        newJWTParser(supportedJWTAlgorithms, config.Issuer, config.Audience),
+		tenantIDClaim: config.TenantIDClaim,
+	}, nil
+}
+
+func newJWTParser(algorithms []string, issuer, audience string) *jwt.Parser {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(algorithms),
+		jwt.WithExpirationRequired(),
+	}
+	if issuer != "" {
+		opts = append(opts, jwt.WithIssuer(issuer))
+	}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	return jwt.NewParser(opts...)
+}
+
+func (v *jwtVerifier) verify(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *jwtVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	keys := v.keys.lookup(kid)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no verification key found for kid %q", kid)
+	}
+
+	set := jwt.VerificationKeySet{}
+	for _, key := range keys {
+		set.Keys = append(set.Keys, key)
+	}
+	return set, nil
+}
+
+// tenantID returns the value of the configured tenant claim, or the static
+// fallback when no claim is configured.
+func (v *jwtVerifier) tenantID(claims jwt.MapClaims, fallback string) (string, error) {
+	if v.tenantIDClaim == "" {
+		return fallback, nil
+	}
+	id, ok := claims[v.tenantIDClaim].(string)
+	if !ok || id == "" {
+		return "", fmt.Errorf("claim %q is missing or is not a string", v.tenantIDClaim)
+	}
+	if err := validateTenantID(id); err != nil {
+		return "", fmt.Errorf("claim %q: %v", v.tenantIDClaim, err)
+	}
+	return id, nil
+}
+
+func (tenant *Tenant) jwtAuth(w http.ResponseWriter, r *http.Request) bool {
+	if tenant.jwtVerifier == nil {
+		return false
+	}
+	token, ok := bearerToken(r)
+	if !ok {
+		return false
+	}
+
+	claims, err := tenant.jwtVerifier.verify(token)
+	if err != nil {
+		logrus.Debugf("JWT verification failed: %v", err)
+		return false
+	}
+	orgID, err := tenant.jwtVerifier.tenantID(claims, tenant.ID)
+	if err != nil {
+		logrus.Debugf("JWT verification failed: %v", err)
+		return false
+	}
+
+	if !tenant.Passthrough {
+		r.Header.Set("X-Scope-OrgID", orgID)
+	}
+	return true
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS skips symmetric keys unless they are allowed.
+func parseJWKS(data []byte, symmetric bool) (staticKeySet, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	var keys staticKeySet
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if jwk.Kty == "oct" && !symmetric {
+			logrus.Warnf("skipping symmetric JSON web key %q", jwk.Kid)
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", jwk.Kid, err)
+		}
+		if key == nil {
+			logrus.Warnf("skipping unsupported JSON web key %q of type %s", jwk.Kid, jwk.Kty)
+			continue
+		}
+		keys = append(keys, jwtKey{id: jwk.Kid, key: key})
+	}
+	return keys, nil
+}
+
+// publicKey returns nil without an error for key types that cannot verify
+// any of the supported algorithms.
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBase64URL(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URL(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA key parameters")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeBase64URL(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URL(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid P-256 coordinates")
+		}
+		// let crypto/ecdh reject points that are not on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "oct":
+		k, err := decodeBase64URL(jwk.K)
+		if err != nil {
+			return nil, err
+		}
+		if len(k) == 0 {
+			return nil, fmt.Errorf("empty symmetric key")
+		}
+		return k, nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func parsePEMKeys(data []byte) (staticKeySet, error) {
+	var keys staticKeySet
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var key interface{}
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			keys = append(keys, jwtKey{key: key})
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,310 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func writeJWKS(t *testing.T, keys ...map[string]string) string {
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func signJWT(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+
+	jwksFile := writeJWKS(t,
+		rsaJWK("rsa-1", &rsaKey.PublicKey),
+		map[string]string{"kty": "oct", "kid": "hmac-1", "k": base64.RawURLEncoding.EncodeToString(hmacKey)},
+	)
+
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	require.NoError(t, err)
+	pemFile := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+
+	now := time.Now()
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":    "https://issuer.example.com",
+			"aud":    "cortex",
+			"exp":    now.Add(time.Hour).Unix(),
+			"nbf":    now.Add(-time.Minute).Unix(),
+			"tenant": "team-a",
+		}
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	jwksTenant := Tenant{
+		Authentication: "jwt",
+		JWT: JWTConfig{
+			JWKSFile:      jwksFile,
+			Issuer:        "https://issuer.example.com",
+			Audience:      "cortex",
+			TenantIDClaim: "tenant",
+		},
+	}
+	pemTenant := Tenant{
+		Authentication: "jwt",
+		ID:             "static-orgid",
+		JWT: JWTConfig{
+			KeyFile: pemFile,
+		},
+	}
+
+	testCases := []struct {
+		name           string
+		tenant         Tenant
+		token          string
+		expectedStatus int
+		expectedOrgID  string
+	}{
+		{
+			name:           "RS256 token from JWKS",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims()),
+			expectedStatus: http.StatusOK,
+			expectedOrgID:  "team-a",
+		},
+		{
+			name:           "HS256 token from JWKS",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodHS256, "hmac-1", hmacKey, validClaims()),
+			expectedStatus: http.StatusOK,
+			expectedOrgID:  "team-a",
+		},
+		{
+			name:           "ES256 token from PEM uses the static tenant ID",
+			tenant:         pemTenant,
+			token:          signJWT(t, jwt.SigningMethodES256, "", ecKey, validClaims()),
+			expectedStatus: http.StatusOK,
+			expectedOrgID:  "static-orgid",
+		},
+		{
+			name:           "token without kid",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "", rsaKey, validClaims()),
+			expectedStatus: http.StatusOK,
+			expectedOrgID:  "team-a",
+		},
+		{
+			name:           "unknown signing key",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-1", otherRSAKey, validClaims()),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown kid",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, validClaims()),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unsupported algorithm",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodHS512, "hmac-1", hmacKey, validClaims()),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unsigned token",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, validClaims()),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "expired token",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("exp", now.Add(-time.Minute).Unix())),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "token without exp",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("exp", nil)),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "token not valid yet",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("nbf", now.Add(time.Hour).Unix())),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong issuer",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("iss", "https://other.example.com")),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong audience",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("aud", "grafana")),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing tenant claim",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("tenant", nil)),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "non-string tenant claim",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("tenant", 42)),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "empty tenant claim",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("tenant", "")),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "tenant claim with separator",
+			tenant:         jwksTenant,
+			token:          signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("tenant", "team-a|team-b")),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "malformed token",
+			tenant:         jwksTenant,
+			token:          "not-a-jwt",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := NewAuthentication(&Config{Tenants: []Tenant{tc.tenant}})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest("GET", "http://localhost", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rw := httptest.NewRecorder()
+
+			var orgID string
+			auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				orgID = r.Header.Get("X-Scope-OrgID")
+			})).ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedStatus, rw.Code)
+			assert.Equal(t, tc.expectedOrgID, orgID)
+		})
+	}
+}
+
+func TestNewJWTVerifier(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    JWTConfig
+		jwks      string
+		expectErr bool
+	}{
+		{
+			name:      "no key source",
+			config:    JWTConfig{},
+			expectErr: true,
+		},
+		{
+			name:      "missing jwks file",
+			config:    JWTConfig{JWKSFile: "testdata/nonexistent.json"},
+			expectErr: true,
+		},
+		{
+			name:      "malformed jwks",
+			jwks:      `{"keys": [`,
+			expectErr: true,
+		},
+		{
+			name:      "invalid RSA key",
+			jwks:      `{"keys": [{"kty": "RSA", "kid": "1", "n": "", "e": "AQAB"}]}`,
+			expectErr: true,
+		},
+		{
+			name:      "EC point not on the curve",
+			jwks:      `{"keys": [{"kty": "EC", "kid": "1", "crv": "P-256", "x": "` + base64.RawURLEncoding.EncodeToString(make([]byte, 32)) + `", "y": "` + base64.RawURLEncoding.EncodeToString(make([]byte, 32)) + `"}]}`,
+			expectErr: true,
+		},
+		{
+			name:      "only unsupported keys",
+			jwks:      `{"keys": [{"kty": "OKP", "kid": "1"}, {"kty": "oct", "kid": "2", "use": "enc", "k": "c2VjcmV0"}]}`,
+			expectErr: true,
+		},
+		{
+			name:      "valid jwks",
+			jwks:      `{"keys": [{"kty": "oct", "kid": "1", "k": "c2VjcmV0"}]}`,
+			expectErr: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.config
+			if tc.jwks != "" {
+				config.JWKSFile = filepath.Join(t.TempDir(), "jwks.json")
+				require.NoError(t, os.WriteFile(config.JWKSFile, []byte(tc.jwks), 0600))
+			}
+
+			_, err := newJWTVerifier(config)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
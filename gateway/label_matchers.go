@@ -0,0 +1,159 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/sirupsen/logrus"
+)
+
+// parseLabelMatchers parses matchers such as namespace="team-a", one per
+// entry.
+func parseLabelMatchers(matchers []string) ([]*labels.Matcher, error) {
+	var parsed []*labels.Matcher
+	for _, matcher := range matchers {
+		m, err := parser.ParseMetricSelector("{" + matcher + "}")
+		if err != nil {
+			return nil, fmt.Errorf("invalid label matcher %q: %v", matcher, err)
+		}
+		if len(m) != 1 {
+			return nil, fmt.Errorf("invalid label matcher %q: exactly one matcher is required", matcher)
+		}
+		parsed = append(parsed, m[0])
+	}
+	return parsed, nil
+}
+
+// labelMatchers returns the matchers enforced on the queries of the identity,
+// falling back from the credential to the tenant.
+func (id identity) labelMatchers() []*labels.Matcher {
+	if id.credential != nil && len(id.credential.labelMatchers) > 0 {
+		return id.credential.labelMatchers
+	}
+	return id.tenant.labelMatchers
+}
+
+// enforceLabels adds the label matchers of the identity to every selector of
+// the PromQL expressions and match[] selectors of a query, and to the queries
+// of remote read requests, like prom-label-proxy does. The matchers are added
+// to those of the client, so a client selecting other label values gets no
+// data rather than someone else's.
+func enforceLabels(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := identityFrom(r.Context())
+		if !ok || len(id.labelMatchers()) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		matchers := id.labelMatchers()
+
+		// metadata has no selectors, so it would list the metrics of the
+		// whole tenant
+		if strings.HasSuffix(r.URL.Path, "/metadata") {
+			forbidden(w, id, reasonPathNotAllowed, "metadata is not available to credentials with label matchers")
+			return
+		}
+
+		var err error
+		if strings.HasSuffix(r.URL.Path, "/read") {
+			err = enforceRemoteRead(r, matchers)
+		} else {
+			err = enforceQueryParams(r, matchers)
+		}
+		if err != nil {
+			logrus.Debugf("enforcing the label matchers of tenant %s: %v", id.tenant.ID, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func enforceQueryParams(r *http.Request, matchers []*labels.Matcher) error {
+	hasMatch := false
+	err := rewriteParams(r, func(params url.Values) error {
+		for i, query := range params["query"] {
+			enforced, err := enforceExpr(query, matchers)
+			if err != nil {
+				return err
+			}
+			params["query"][i] = enforced
+		}
+		for i, selector := range params["match[]"] {
+			enforced, err := enforceExpr(selector, matchers)
+			if err != nil {
+				return err
+			}
+			params["match[]"][i] = enforced
+			hasMatch = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// series, label names and label values are scoped by match[] selectors,
+	// which are optional for the latter two
+	if !hasMatch && selectsByMatch(r.URL.Path) {
+		query := r.URL.Query()
+		query.Set("match[]", (&parser.VectorSelector{LabelMatchers: matchers}).String())
+		r.URL.RawQuery = query.Encode()
+	}
+	return nil
+}
+
+func selectsByMatch(path string) bool {
+	return strings.HasSuffix(path, "/series") || strings.HasSuffix(path, "/labels") ||
+		(strings.Contains(path, "/label/") && strings.HasSuffix(path, "/values"))
+}
+
+func enforceExpr(query string, matchers []*labels.Matcher) (string, error) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid query %q: %v", query, err)
+	}
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if selector, ok := node.(*parser.VectorSelector); ok {
+			selector.LabelMatchers = append(selector.LabelMatchers, matchers...)
+		}
+		return nil
+	})
+	return expr.String(), nil
+}
+
+var remoteReadMatchTypes = map[labels.MatchType]prompb.LabelMatcher_Type{
+	labels.MatchEqual:     prompb.LabelMatcher_EQ,
+	labels.MatchNotEqual:  prompb.LabelMatcher_NEQ,
+	labels.MatchRegexp:    prompb.LabelMatcher_RE,
+	labels.MatchNotRegexp: prompb.LabelMatcher_NRE,
+}
+
+func enforceRemoteRead(r *http.Request, matchers []*labels.Matcher) error {
+	body, err := readProtoBody(r)
+	if err != nil {
+		return err
+	}
+	req := &prompb.ReadRequest{}
+	if err := decodeProto(body, req); err != nil {
+		return fmt.Errorf("malformed remote read request: %v", err)
+	}
+	for _, query := range req.Queries {
+		for _, m := range matchers {
+			query.Matchers = append(query.Matchers, &prompb.LabelMatcher{Type: remoteReadMatchTypes[m.Type], Name: m.Name, Value: m.Value})
+		}
+	}
+	if body, err = encodeProto(req); err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return nil
+}
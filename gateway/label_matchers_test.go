@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnforceLabels(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication: "bearer",
+			ID:             "shared",
+			LabelMatchers:  []string{`namespace="team-a"`},
+			Credentials: []Credential{
+				{Token: "team-a"},
+				{Token: "team-b", LabelMatchers: []string{`namespace=~"team-b|team-c"`}},
+			},
+		},
+		{Authentication: "bearer", Token: "admin", ID: "admin"},
+	}})
+	require.NoError(t, err)
+
+	var forwarded *http.Request
+	var forwardedBody []byte
+	handler := auth.Wrap(enforceLabels(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r
+		forwardedBody, _ = io.ReadAll(r.Body)
+		assert.Equal(t, int64(len(forwardedBody)), r.ContentLength)
+	})))
+
+	send := func(token string, req *http.Request) *httptest.ResponseRecorder {
+		forwarded, forwardedBody = nil, nil
+		req.Header.Set("Authorization", "Bearer "+token)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	t.Run("query", func(t *testing.T) {
+		rw := send("team-a", httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query="+url.QueryEscape(`sum(rate(http_requests_total{code="500"}[5m])) / sum(rate(http_requests_total[5m]))`), nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, `sum(rate(http_requests_total{code="500",namespace="team-a"}[5m])) / sum(rate(http_requests_total{namespace="team-a"}[5m]))`, forwarded.URL.Query().Get("query"))
+	})
+
+	t.Run("form encoded query range", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "http://localhost/api/prom/api/v1/query_range", strings.NewReader("query=up&step=15"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rw := send("team-b", req)
+		require.Equal(t, http.StatusOK, rw.Code)
+		form, err := url.ParseQuery(string(forwardedBody))
+		require.NoError(t, err)
+		assert.Equal(t, `up{namespace=~"team-b|team-c"}`, form.Get("query"))
+		assert.Equal(t, "15", form.Get("step"))
+	})
+
+	t.Run("multipart form", func(t *testing.T) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		require.NoError(t, writer.WriteField("query", `up{namespace="team-b"}`))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest("POST", "http://localhost/prometheus/api/v1/query", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rw := send("team-a", req)
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+		assert.Nil(t, forwarded)
+	})
+
+	t.Run("series", func(t *testing.T) {
+		rw := send("team-a", httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/series?match[]=up&match[]="+url.QueryEscape(`{job="api"}`), nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, []string{`up{namespace="team-a"}`, `{job="api",namespace="team-a"}`}, forwarded.URL.Query()["match[]"])
+	})
+
+	t.Run("label names without match", func(t *testing.T) {
+		rw := send("team-a", httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/labels", nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, []string{`{namespace="team-a"}`}, forwarded.URL.Query()["match[]"])
+	})
+
+	t.Run("label values without match", func(t *testing.T) {
+		rw := send("team-a", httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/label/job/values", nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, []string{`{namespace="team-a"}`}, forwarded.URL.Query()["match[]"])
+	})
+
+	t.Run("remote read", func(t *testing.T) {
+		body, err := encodeProto(&prompb.ReadRequest{Queries: []*prompb.Query{{
+			Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+		}}})
+		require.NoError(t, err)
+		rw := send("team-b", httptest.NewRequest("POST", "http://localhost/prometheus/api/v1/read", bytes.NewReader(body)))
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		req := &prompb.ReadRequest{}
+		require.NoError(t, decodeProto(forwardedBody, req))
+		assert.Equal(t, []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+			{Type: prompb.LabelMatcher_RE, Name: "namespace", Value: "team-b|team-c"},
+		}, req.Queries[0].Matchers)
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		rw := send("team-a", httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/metadata", nil))
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+		assert.Contains(t, rw.Body.String(), reasonPathNotAllowed)
+		assert.Nil(t, forwarded)
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		rw := send("team-a", httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query=sum(", nil))
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+		assert.Nil(t, forwarded)
+	})
+
+	t.Run("unscoped tenant", func(t *testing.T) {
+		rw := send("admin", httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query=up", nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "up", forwarded.URL.Query().Get("query"))
+	})
+}
+
+func TestInvalidLabelMatchers(t *testing.T) {
+	for _, matchers := range [][]string{{`namespace`}, {`namespace="a",job="b"`}, {`namespace=~"("`}} {
+		_, err := NewAuthentication(&Config{Tenants: []Tenant{
+			{Authentication: "bearer", Token: "token", ID: "tenant", LabelMatchers: matchers},
+		}})
+		assert.Error(t, err, matchers)
+
+		_, err = NewAuthentication(&Config{Tenants: []Tenant{
+			{Authentication: "bearer", ID: "tenant", Credentials: []Credential{{Token: "token", LabelMatchers: matchers}}},
+		}})
+		assert.Error(t, err, matchers)
+	}
+}
@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFailureWindow      = 15 * time.Minute
+	defaultLockoutDuration    = time.Minute
+	defaultMaxLockoutDuration = time.Hour
+	lockoutMaxEntries         = 100000
+)
+
+type failureRecord struct {
+	failures    int
+	lockedUntil time.Time
+}
+
+// lockout tracks failed authentications per username and per client IP. Once
+// a key reaches max_failures, it is locked for lockout_duration, which doubles
+// with every further failure up to max_lockout_duration. Failures are
+// forgotten after failure_window without a new one.
+type lockout struct {
+	config  LockoutConfig
+	records *ttlCache[failureRecord]
+	// serializes the read-modify-write of a record
+	sync.Mutex
+}
+
+func newLockout(config LockoutConfig) (*lockout, error) {
+	if config.MaxFailures < 0 {
+		return nil, fmt.Errorf("lockout max_failures must not be negative")
+	}
+	if config.MaxFailures == 0 {
+		return nil, nil
+	}
+	if config.FailureWindow == 0 {
+		config.FailureWindow = defaultFailureWindow
+	}
+	if config.LockoutDuration == 0 {
+		config.LockoutDuration = defaultLockoutDuration
+	}
+	if config.MaxLockoutDuration == 0 {
+		config.MaxLockoutDuration = defaultMaxLockoutDuration
+	}
+	if config.MaxLockoutDuration < config.LockoutDuration {
+		return nil, fmt.Errorf("lockout max_lockout_duration must not be shorter than lockout_duration")
+	}
+
+	records := newTTLCache[failureRecord](lockoutMaxEntries)
+	// filling the cache with failures must not lift the locks in place
+	records.keep = func(record failureRecord, now time.Time) bool {
+		return record.lockedUntil.After(now)
+	}
+
+	return &lockout{
+		config:  config,
+		records: records,
+	}, nil
+}
+
+// lockoutKeys returns the keys failures of the request are tracked under: the
+// client IP first, followed by the basic auth username if there is one.
+func lockoutKeys(r *http.Request) []cacheKey {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	keys := []cacheKey{newCacheKey("ip", host)}
+	if username, _, ok := r.BasicAuth(); ok {
+		keys = append(keys, newCacheKey("user", username))
+	}
+	return keys
+}
+
+// lockedFor returns how long the longest lock among the keys still lasts.
+func (l *lockout) lockedFor(keys ...cacheKey) time.Duration {
+	now := time.Now()
+	var remaining time.Duration
+	for _, key := range keys {
+		if record, ok := l.records.get(key); ok && record.lockedUntil.After(now) {
+			if d := record.lockedUntil.Sub(now); d > remaining {
+				remaining = d
+			}
+		}
+	}
+	return remaining
+}
+
+func (l *lockout) fail(keys ...cacheKey) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		record, _ := l.records.get(key)
+		record.failures++
+		if excess := record.failures - l.config.MaxFailures; excess >= 0 {
+			record.lockedUntil = now.Add(l.lockoutDuration(excess))
+		}
+		expiry := now.Add(l.config.FailureWindow)
+		if record.lockedUntil.After(expiry) {
+			expiry = record.lockedUntil
+		}
+		l.records.set(key, record, expiry)
+	}
+}
+
+func (l *lockout) lockoutDuration(excess int) time.Duration {
+	duration := l.config.LockoutDuration
+	for i := 0; i < excess && duration < l.config.MaxLockoutDuration; i++ {
+		duration *= 2
+	}
+	if duration > l.config.MaxLockoutDuration {
+		duration = l.config.MaxLockoutDuration
+	}
+	return duration
+}
+
+func (l *lockout) reset(keys ...cacheKey) {
+	for _, key := range keys {
+		l.records.delete(key)
+	}
+}
+
+// tooManyRequests answers a request whose username or client IP is locked.
+func tooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	logrus.Warnf("rejecting a request from %s, too many failed authentications", r.RemoteAddr)
+	w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+}
+
+// retryAfterSeconds formats a duration for the Retry-After header, rounded up
+// to whole seconds.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
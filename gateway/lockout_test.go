@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lockoutRequest(handler http.Handler, remoteAddr, username, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	req.RemoteAddr = remoteAddr
+	req.SetBasicAuth(username, password)
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	return rw
+}
+
+func TestLockout(t *testing.T) {
+	newHandler := func(t *testing.T) http.Handler {
+		auth, err := NewAuthentication(&Config{
+			Tenants: []Tenant{
+				{Authentication: "basic", Username: "alice", Password: "alice", ID: "a"},
+				{Authentication: "basic", Username: "bob", Password: "bob", ID: "b"},
+			},
+			Lockout: LockoutConfig{MaxFailures: 3},
+		})
+		require.NoError(t, err)
+		return auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+
+	t.Run("locks the client IP and the username", func(t *testing.T) {
+		handler := newHandler(t)
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, lockoutRequest(handler, "10.0.0.1:1234", "alice", "wrong").Code)
+		}
+
+		rw := lockoutRequest(handler, "10.0.0.1:1234", "alice", "alice")
+		assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+		retryAfter, err := strconv.Atoi(rw.Header().Get("Retry-After"))
+		require.NoError(t, err)
+		assert.InDelta(t, 60, retryAfter, 1)
+
+		// the same username from another client IP
+		assert.Equal(t, http.StatusTooManyRequests, lockoutRequest(handler, "10.0.0.2:1234", "alice", "alice").Code)
+		// another username from the same client IP
+		assert.Equal(t, http.StatusTooManyRequests, lockoutRequest(handler, "10.0.0.1:1234", "bob", "bob").Code)
+		// neither is locked
+		assert.Equal(t, http.StatusOK, lockoutRequest(handler, "10.0.0.2:1234", "bob", "bob").Code)
+	})
+
+	t.Run("a success resets the username", func(t *testing.T) {
+		handler := newHandler(t)
+		lockoutRequest(handler, "10.0.0.1:1234", "alice", "wrong")
+		lockoutRequest(handler, "10.0.0.2:1234", "alice", "wrong")
+		assert.Equal(t, http.StatusOK, lockoutRequest(handler, "10.0.0.3:1234", "alice", "alice").Code)
+		lockoutRequest(handler, "10.0.0.4:1234", "alice", "wrong")
+		lockoutRequest(handler, "10.0.0.5:1234", "alice", "wrong")
+		assert.Equal(t, http.StatusOK, lockoutRequest(handler, "10.0.0.6:1234", "alice", "alice").Code)
+	})
+
+	t.Run("a success does not reset the client IP", func(t *testing.T) {
+		handler := newHandler(t)
+		lockoutRequest(handler, "10.0.0.1:1234", "alice", "wrong")
+		lockoutRequest(handler, "10.0.0.1:1234", "alice", "wrong")
+		assert.Equal(t, http.StatusOK, lockoutRequest(handler, "10.0.0.1:1234", "bob", "bob").Code)
+		lockoutRequest(handler, "10.0.0.1:1234", "carol", "wrong")
+		assert.Equal(t, http.StatusTooManyRequests, lockoutRequest(handler, "10.0.0.1:1234", "bob", "bob").Code)
+	})
+
+	t.Run("failures outside the window are forgotten", func(t *testing.T) {
+		auth, err := NewAuthentication(&Config{
+			Tenants: []Tenant{{Authentication: "basic", Username: "alice", Password: "alice", ID: "a"}},
+			Lockout: LockoutConfig{MaxFailures: 2, FailureWindow: 50 * time.Millisecond},
+		})
+		require.NoError(t, err)
+		handler := auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		lockoutRequest(handler, "10.0.0.1:1234", "alice", "wrong")
+		time.Sleep(100 * time.Millisecond)
+		lockoutRequest(handler, "10.0.0.1:1234", "alice", "wrong")
+		assert.Equal(t, http.StatusOK, lockoutRequest(handler, "10.0.0.1:1234", "alice", "alice").Code)
+	})
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	l, err := newLockout(LockoutConfig{MaxFailures: 2, LockoutDuration: time.Minute, MaxLockoutDuration: 5 * time.Minute})
+	require.NoError(t, err)
+
+	key := newCacheKey("ip", "10.0.0.1")
+	l.fail(key)
+	assert.Zero(t, l.lockedFor(key))
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for _, duration := range expected {
+		l.fail(key)
+		assert.InDelta(t, duration.Seconds(), l.lockedFor(key).Seconds(), 1)
+	}
+
+	l.reset(key)
+	assert.Zero(t, l.lockedFor(key))
+}
+
+func TestLockoutSurvivesAFullCache(t *testing.T) {
+	l, err := newLockout(LockoutConfig{MaxFailures: 2, LockoutDuration: time.Hour})
+	require.NoError(t, err)
+	l.records.maxEntries = 100
+
+	admin := newCacheKey("user", "admin")
+	l.fail(admin)
+	l.fail(admin)
+	require.Greater(t, l.lockedFor(admin), time.Duration(0))
+
+	// single failures from many client IPs do not wipe the lock
+	for i := 0; i < 1000; i++ {
+		l.fail(newCacheKey("ip", strconv.Itoa(i)))
+	}
+	assert.LessOrEqual(t, l.records.len(), 100)
+	assert.Greater(t, l.lockedFor(admin), time.Duration(0))
+}
+
+func TestNewLockout(t *testing.T) {
+	l, err := newLockout(LockoutConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, l, "lockout is disabled without max_failures")
+
+	l, err = newLockout(LockoutConfig{MaxFailures: 5})
+	require.NoError(t, err)
+	assert.Equal(t, LockoutConfig{
+		MaxFailures:        5,
+		FailureWindow:      defaultFailureWindow,
+		LockoutDuration:    defaultLockoutDuration,
+		MaxLockoutDuration: defaultMaxLockoutDuration,
+	}, l.config)
+
+	_, err = newLockout(LockoutConfig{MaxFailures: -1})
+	assert.Error(t, err)
+
+	_, err = newLockout(LockoutConfig{MaxFailures: 5, LockoutDuration: time.Hour, MaxLockoutDuration: time.Minute})
+	assert.Error(t, err)
+}
@@ -1,21 +1,94 @@
 package gateway
 
 import (
-	"crypto/subtle"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/cortexproject/auth-gateway/middleware"
 	"github.com/sirupsen/logrus"
 )
 
+const defaultAPIKeyHeader = "X-API-Key"
+
 type Authentication struct {
-	config *Config
+	config  *Config
+	index   *credentialIndex
+	lockout *lockout
 }
 
-func NewAuthentication(config *Config) *Authentication {
-	return &Authentication{
-		config: config,
+func NewAuthentication(config *Config) (*Authentication, error) {
+	if config.Admin.TLS != (TLSConfig{}) {
+		return nil, fmt.Errorf("tls is only supported on the main server, not on the admin server")
+	}
+	for i := range config.Tenants {
+		tenant := &config.Tenants[i]
+		err := validateRoles(tenant.Roles)
+		if err == nil {
+			err = tenant.initAllowlists()
+		}
+		if err == nil {
+			err = tenant.validateReadTenantIDs(tenant.ReadTenantIDs)
+		}
+		if err == nil {
+			err = tenant.validateAllowedOrgIDs(tenant.AllowedOrgIDs)
+		}
+		if err == nil {
+			err = validateRateLimits(tenant.RateLimits)
+		}
+		if err == nil {
+			err = tenant.IngestionLimits.validate()
+		}
+		if err == nil {
+			err = tenant.QueryConcurrency.init()
+		}
+		if err == nil {
+			err = tenant.RemoteWriteLimits.init()
+		}
+		if err == nil {
+			err = validateRelabelConfigs(tenant.RelabelConfigs)
+		}
+		if err == nil {
+			tenant.labelMatchers, err = parseLabelMatchers(tenant.LabelMatchers)
+		}
+		if err == nil {
+			err = tenant.QueryLimits.validate()
+		}
+		if err == nil {
+			err = tenant.QueryPolicy.validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %v", tenant.ID, err)
+		}
+		switch tenant.Authentication {
+		case "basic", "bearer", "api_key":
+			err = tenant.initCredentials()
+		case "mtls":
+			err = tenant.MTLS.validate(config.Server.TLS)
+		case "jwt":
+			tenant.jwtVerifier, err = newJWTVerifier(tenant.JWT)
+		case "oidc":
+			tenant.jwtVerifier, err = newOIDCVerifier(tenant.OIDC)
+		case "ext_authz":
+			tenant.extAuthz, err = newExtAuthzClient(tenant.ExtAuthz)
+		case "introspection":
+			tenant.introspection, err = newIntrospectionClient(tenant.Introspection)
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	lockout, err := newLockout(config.Lockout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authentication{
+		config:  config,
+		index:   newCredentialIndex(config.Tenants),
+		lockout: lockout,
+	}, nil
 }
 
 func (a Authentication) Wrap(next http.Handler) http.Handler {
@@ -23,19 +96,84 @@ func (a Authentication) Wrap(next http.Handler) http.Handler {
 		sr := &middleware.StatusRecorder{
 			ResponseWriter: w,
 		}
+		// only passthrough tenants may choose their org ID, so the client's
+		// header is removed before authenticating and restored for them
+		orgIDs := r.Header.Values("X-Scope-OrgID")
+		r.Header.Del("X-Scope-OrgID")
+
+		var failureKeys []cacheKey
+		if a.lockout != nil {
+			failureKeys = lockoutKeys(r)
+			if retryAfter := a.lockout.lockedFor(failureKeys...); retryAfter > 0 {
+				tooManyRequests(sr, r, retryAfter)
+				return
+			}
+		}
+
 		ok := false
-		for _, tenant := range a.config.Tenants {
-			if tenant.Authentication == "basic" {
-				ok = tenant.basicAuth(sr, r)
-				if ok {
-					break
+		var id identity
+		var failedOpen *Tenant
+		for _, i := range a.index.candidates(r) {
+			tenant := &a.config.Tenants[i]
+			id = identity{tenant: tenant}
+			switch tenant.Authentication {
+			case "basic":
+				id.credential = tenant.basicAuth(sr, r)
+				ok = id.credential != nil
+			case "bearer":
+				id.credential = tenant.bearerAuth(sr, r)
+				ok = id.credential != nil
+			case "api_key":
+				id.credential = tenant.apiKeyAuth(sr, r)
+				ok = id.credential != nil
+			case "jwt", "oidc":
+				ok = tenant.jwtAuth(sr, r)
+			case "mtls":
+				ok = tenant.mtlsAuth(sr, r)
+			case "ext_authz":
+				var unavailable bool
+				ok, unavailable = tenant.extAuthzAuth(sr, r)
+				if unavailable && failedOpen == nil {
+					failedOpen = tenant
 				}
+			case "introspection":
+				ok = tenant.introspectionAuth(sr, r)
+			}
+			if ok {
+				break
+			}
+		}
+		// an unreachable authorization service must not take over requests
+		// that carry valid credentials of another tenant
+		if !ok && failedOpen != nil {
+			logrus.Warnf("authorization service unavailable, allowing the request")
+			failedOpen.setOrgID(r)
+			id = identity{tenant: failedOpen}
+			ok = true
+		}
+
+		if a.lockout != nil {
+			if ok {
+				// only the username is reset, a client IP cannot clear its
+				// failures with a valid credential of its own
+				a.lockout.reset(failureKeys[1:]...)
+			} else {
+				a.lockout.fail(failureKeys...)
+			}
+		}
+
+		if ok && id.tenant.Passthrough {
+			if reason, message := id.checkOrgIDs(orgIDs); reason != "" {
+				forbidden(sr, id, reason, message)
+				return
+			}
+			for _, orgID := range orgIDs {
+				r.Header.Add("X-Scope-OrgID", orgID)
 			}
-			// add other authentication methods if necessary
 		}
 
 		if ok {
-			next.ServeHTTP(sr, r)
+			next.ServeHTTP(sr, withIdentity(r, id))
 		} else {
 			logrus.Debugf("No valid tenant credentials are found")
 			sr.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
@@ -44,32 +182,88 @@ func (a Authentication) Wrap(next http.Handler) http.Handler {
 	})
 }
 
-func (tenant *Tenant) basicAuth(w http.ResponseWriter, r *http.Request) bool {
+func (tenant *Tenant) basicAuth(w http.ResponseWriter, r *http.Request) *Credential {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return false
+		return nil
 	}
 	username, password, ok := r.BasicAuth()
 	if !ok {
-		return false
+		return nil
+	}
+
+	credential := tenant.matchBasic(username, password)
+	if credential == nil {
+		return nil
+	}
+
+	tenant.setOrgID(r)
+	return credential
+}
+
+func (tenant *Tenant) bearerAuth(w http.ResponseWriter, r *http.Request) *Credential {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil
+	}
+	credential := tenant.matchToken(token)
+	if credential == nil {
+		return nil
 	}
 
-	if !tenant.saveCompare(username, password) {
-		return false
+	tenant.setOrgID(r)
+	return credential
+}
+
+// apiKeyAuth removes the key from the request once it matched, so that it is
+// never forwarded to Cortex.
+func (tenant *Tenant) apiKeyAuth(w http.ResponseWriter, r *http.Request) *Credential {
+	if header := tenant.APIKey.header(); header != "" {
+		if key := r.Header.Get(header); key != "" {
+			if credential := tenant.matchKey(key); credential != nil {
+				r.Header.Del(header)
+				tenant.setOrgID(r)
+				return credential
+			}
+		}
+	}
+
+	if tenant.APIKey.QueryParam != "" {
+		query := r.URL.Query()
+		if key := query.Get(tenant.APIKey.QueryParam); key != "" {
+			if credential := tenant.matchKey(key); credential != nil {
+				query.Del(tenant.APIKey.QueryParam)
+				r.URL.RawQuery = query.Encode()
+				tenant.setOrgID(r)
+				return credential
+			}
+		}
 	}
 
+	return nil
+}
+
+// header returns the header the key is read from, which defaults to
+// X-API-Key unless the key is only accepted as a query parameter.
+func (c APIKeyConfig) header() string {
+	if c.Header == "" && c.QueryParam == "" {
+		return defaultAPIKeyHeader
+	}
+	return c.Header
+}
+
+func (tenant *Tenant) setOrgID(r *http.Request) {
 	if !tenant.Passthrough {
 		r.Header.Set("X-Scope-OrgID", tenant.ID)
 	}
-	return true
 }
 
-// attempt to mitigate timing attacks
-func (tenant *Tenant) saveCompare(username, password string) bool {
-	userNameCheck := subtle.ConstantTimeCompare([]byte(tenant.Username), []byte(username))
-	passwordCheck := subtle.ConstantTimeCompare([]byte(tenant.Password), []byte(password))
-	if userNameCheck == 1 && passwordCheck == 1 {
-		return true
+func bearerToken(r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	prefix := "Bearer "
+	if len(authHeader) < len(prefix) || !strings.EqualFold(authHeader[:len(prefix)], prefix) {
+		return "", false
 	}
-	return false
+	token := strings.TrimSpace(authHeader[len(prefix):])
+	return token, token != ""
 }
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"encoding/base64"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -13,6 +14,7 @@ func TestAuthenticate(t *testing.T) {
 		config         *Config
 		authHeader     string
 		expectedStatus int
+		expectedOrgID  string
 	}{
 		{
 			name: "missing auth header",
@@ -88,6 +90,68 @@ func TestAuthenticate(t *testing.T) {
 			authHeader:     "Basic " + base64.StdEncoding.EncodeToString([]byte("username2:password2")),
 			expectedStatus: http.StatusUnauthorized,
 		},
+		{
+			name: "valid bearer token",
+			config: &Config{
+				Tenants: []Tenant{
+					{
+						Authentication: "basic",
+						Username:       "username1",
+						Password:       "password1",
+						ID:             "orgid1",
+					},
+					{
+						Authentication: "bearer",
+						Token:          "token2",
+						ID:             "orgid2",
+					},
+				},
+			},
+			authHeader:     "Bearer token2",
+			expectedStatus: http.StatusOK,
+			expectedOrgID:  "orgid2",
+		},
+		{
+			name: "wrong bearer token",
+			config: &Config{
+				Tenants: []Tenant{
+					{
+						Authentication: "bearer",
+						Token:          "token1",
+						ID:             "orgid1",
+					},
+				},
+			},
+			authHeader:     "Bearer token2",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "empty bearer token",
+			config: &Config{
+				Tenants: []Tenant{
+					{
+						Authentication: "bearer",
+						ID:             "orgid1",
+					},
+				},
+			},
+			authHeader:     "Bearer ",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "basic credentials for a bearer tenant",
+			config: &Config{
+				Tenants: []Tenant{
+					{
+						Authentication: "bearer",
+						Token:          "token1",
+						ID:             "orgid1",
+					},
+				},
+			},
+			authHeader:     "Basic " + base64.StdEncoding.EncodeToString([]byte("username1:token1")),
+			expectedStatus: http.StatusUnauthorized,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -103,14 +167,204 @@ func TestAuthenticate(t *testing.T) {
 
 			rw := httptest.NewRecorder()
 
-			auth := NewAuthentication(tc.config)
+			auth, err := NewAuthentication(tc.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var orgID string
 			auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				orgID = r.Header.Get("X-Scope-OrgID")
 				w.WriteHeader(http.StatusOK)
 			})).ServeHTTP(rw, req)
 
 			if rw.Code != tc.expectedStatus {
 				t.Errorf("expected status code %d, but got %d", tc.expectedStatus, rw.Code)
 			}
+
+			if tc.expectedOrgID != "" && orgID != tc.expectedOrgID {
+				t.Errorf("expected X-Scope-OrgID %q, but got %q", tc.expectedOrgID, orgID)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	testCases := []struct {
+		name           string
+		apiKey         APIKeyConfig
+		url            string
+		headers        map[string]string
+		expectedStatus int
+		expectedQuery  string
+	}{
+		{
+			name:           "default header",
+			apiKey:         APIKeyConfig{Key: "key1"},
+			url:            "http://localhost/api/v1/push",
+			headers:        map[string]string{"X-API-Key": "key1"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "custom header",
+			apiKey:         APIKeyConfig{Key: "key1", Header: "X-Sender-Key"},
+			url:            "http://localhost/api/v1/push",
+			headers:        map[string]string{"X-Sender-Key": "key1"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "custom header does not accept the default header",
+			apiKey:         APIKeyConfig{Key: "key1", Header: "X-Sender-Key"},
+			url:            "http://localhost/api/v1/push",
+			headers:        map[string]string{"X-API-Key": "key1"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong key",
+			apiKey:         APIKeyConfig{Key: "key1"},
+			url:            "http://localhost/api/v1/push",
+			headers:        map[string]string{"X-API-Key": "key2"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "query parameter",
+			apiKey:         APIKeyConfig{Key: "key1", QueryParam: "api_key"},
+			url:            "http://localhost/prometheus/api/v1/query?query=up&api_key=key1",
+			expectedStatus: http.StatusOK,
+			expectedQuery:  "query=up",
+		},
+		{
+			name:           "query parameter only",
+			apiKey:         APIKeyConfig{Key: "key1", QueryParam: "api_key"},
+			url:            "http://localhost/api/v1/push",
+			headers:        map[string]string{"X-API-Key": "key1"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "header or query parameter",
+			apiKey:         APIKeyConfig{Key: "key1", Header: "X-API-Key", QueryParam: "api_key"},
+			url:            "http://localhost/api/v1/push",
+			headers:        map[string]string{"X-API-Key": "key1"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "no key configured",
+			apiKey:         APIKeyConfig{},
+			url:            "http://localhost/api/v1/push",
+			headers:        map[string]string{"X-API-Key": ""},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := NewAuthentication(&Config{
+				Tenants: []Tenant{
+					{
+						Authentication: "api_key",
+						APIKey:         tc.apiKey,
+						ID:             "orgid",
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			req := httptest.NewRequest("GET", tc.url, nil)
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+			rw := httptest.NewRecorder()
+
+			var forwarded *http.Request
+			auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = r
+			})).ServeHTTP(rw, req)
+
+			if rw.Code != tc.expectedStatus {
+				t.Fatalf("expected status code %d, but got %d", tc.expectedStatus, rw.Code)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			if orgID := forwarded.Header.Get("X-Scope-OrgID"); orgID != "orgid" {
+				t.Errorf("expected X-Scope-OrgID %q, but got %q", "orgid", orgID)
+			}
+			for name := range tc.headers {
+				if value := forwarded.Header.Get(name); value != "" {
+					t.Errorf("expected the %s header to be stripped, but got %q", name, value)
+				}
+			}
+			if forwarded.URL.RawQuery != tc.expectedQuery {
+				t.Errorf("expected query %q, but got %q", tc.expectedQuery, forwarded.URL.RawQuery)
+			}
+		})
+	}
+}
+
+func BenchmarkAuthenticate(b *testing.B) {
+	const tenantCount = 10000
+
+	benchmarks := []struct {
+		name    string
+		tenant  func(i int) Tenant
+		setAuth func(r *http.Request, i int)
+	}{
+		{
+			name: "basic",
+			tenant: func(i int) Tenant {
+				return Tenant{Authentication: "basic", Username: fmt.Sprintf("user%d", i), Password: fmt.Sprintf("password%d", i)}
+			},
+			setAuth: func(r *http.Request, i int) {
+				r.SetBasicAuth(fmt.Sprintf("user%d", i), fmt.Sprintf("password%d", i))
+			},
+		},
+		{
+			name: "bearer",
+			tenant: func(i int) Tenant {
+				return Tenant{Authentication: "bearer", Token: fmt.Sprintf("token%d", i)}
+			},
+			setAuth: func(r *http.Request, i int) {
+				r.Header.Set("Authorization", fmt.Sprintf("Bearer token%d", i))
+			},
+		},
+		{
+			name: "api_key",
+			tenant: func(i int) Tenant {
+				return Tenant{Authentication: "api_key", APIKey: APIKeyConfig{Key: fmt.Sprintf("key%d", i)}}
+			},
+			setAuth: func(r *http.Request, i int) {
+				r.Header.Set(defaultAPIKeyHeader, fmt.Sprintf("key%d", i))
+			},
+		},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			tenants := make([]Tenant, tenantCount)
+			for i := range tenants {
+				tenants[i] = bm.tenant(i)
+				tenants[i].ID = fmt.Sprintf("orgid%d", i)
+			}
+			auth, err := NewAuthentication(&Config{Tenants: tenants})
+			if err != nil {
+				b.Fatalf("unexpected error: %v", err)
+			}
+			handler := auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			// the last tenant is the worst case for a scan over all tenants
+			req := httptest.NewRequest("POST", "http://localhost/api/v1/push", nil)
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				bm.setAuth(req, tenantCount-1)
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+				if rw.Code != http.StatusOK {
+					b.Fatalf("expected status code %d, but got %d", http.StatusOK, rw.Code)
+				}
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "requests/s")
 		})
 	}
 }
@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func (tenant *Tenant) mtlsAuth(w http.ResponseWriter, r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return false
+	}
+
+	if !tenant.MTLS.matches(r.TLS.PeerCertificates[0], len(r.TLS.VerifiedChains) > 0) {
+		return false
+	}
+
+	tenant.setOrgID(r)
+	return true
+}
+
+// validate rejects tenants that could never authenticate with the TLS
+// configuration of the main server.
+func (c MTLSConfig) validate(serverTLS TLSConfig) error {
+	if serverTLS.CertFile == "" {
+		return fmt.Errorf("mtls authentication requires the server to serve TLS")
+	}
+	if (c.SubjectCN != "" || c.URISAN != "") && serverTLS.ClientCAFile == "" {
+		return fmt.Errorf("mtls subject_cn and uri_san require a server tls client_ca_file")
+	}
+	return nil
+}
+
+// matches requires every configured identifier to match the client certificate.
+// The subject CN and URI SAN are only trusted when the certificate was verified
+// against the client CA, while a fingerprint pins the exact certificate and is
+// therefore accepted for unverified certificates as well.
+func (c MTLSConfig) matches(cert *x509.Certificate, verified bool) bool {
+	if c.SubjectCN == "" && c.URISAN == "" && c.Fingerprint == "" {
+		return false
+	}
+
+	if c.SubjectCN != "" && (!verified || cert.Subject.CommonName != c.SubjectCN) {
+		return false
+	}
+
+	if c.URISAN != "" {
+		if !verified {
+			return false
+		}
+		found := false
+		for _, uri := range cert.URIs {
+			if uri.String() == c.URISAN {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if c.Fingerprint != "" {
+		sum := sha256.Sum256(cert.Raw)
+		if normalizeFingerprint(c.Fingerprint) != hex.EncodeToString(sum[:]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// normalizeFingerprint accepts both "AB:CD:..." and "abcd..." notations.
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
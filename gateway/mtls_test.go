@@ -0,0 +1,232 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the certificate files are only loaded by the server
+var mtlsServer = ServerConfig{TLS: TLSConfig{CertFile: "server.pem", KeyFile: "server-key.pem", ClientCAFile: "ca.pem"}}
+
+func newClientCert(t *testing.T, cn string, uri string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if uri != "" {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		template.URIs = []*url.URL{u}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestMTLSAuthentication(t *testing.T) {
+	cert := newClientCert(t, "cluster-a", "spiffe://example.com/cluster-a")
+	otherCert := newClientCert(t, "cluster-b", "spiffe://example.com/cluster-b")
+	sum := sha256.Sum256(cert.Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	testCases := []struct {
+		name           string
+		mtls           MTLSConfig
+		cert           *x509.Certificate
+		verified       bool
+		expectedStatus int
+	}{
+		{
+			name:           "matching subject CN",
+			mtls:           MTLSConfig{SubjectCN: "cluster-a"},
+			cert:           cert,
+			verified:       true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "matching subject CN on an unverified certificate",
+			mtls:           MTLSConfig{SubjectCN: "cluster-a"},
+			cert:           cert,
+			verified:       false,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "different subject CN",
+			mtls:           MTLSConfig{SubjectCN: "cluster-a"},
+			cert:           otherCert,
+			verified:       true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "matching URI SAN",
+			mtls:           MTLSConfig{URISAN: "spiffe://example.com/cluster-a"},
+			cert:           cert,
+			verified:       true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "different URI SAN",
+			mtls:           MTLSConfig{URISAN: "spiffe://example.com/cluster-a"},
+			cert:           otherCert,
+			verified:       true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "matching fingerprint on an unverified certificate",
+			mtls:           MTLSConfig{Fingerprint: fingerprint},
+			cert:           cert,
+			verified:       false,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "matching colon separated fingerprint",
+			mtls:           MTLSConfig{Fingerprint: strings.ToUpper(colonSeparated(fingerprint))},
+			cert:           cert,
+			verified:       false,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "different fingerprint",
+			mtls:           MTLSConfig{Fingerprint: fingerprint},
+			cert:           otherCert,
+			verified:       true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "all identifiers must match",
+			mtls:           MTLSConfig{SubjectCN: "cluster-a", URISAN: "spiffe://example.com/cluster-b"},
+			cert:           cert,
+			verified:       true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "no identifiers configured",
+			mtls:           MTLSConfig{},
+			cert:           cert,
+			verified:       true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "no client certificate",
+			mtls:           MTLSConfig{SubjectCN: "cluster-a"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := NewAuthentication(&Config{
+				Server: mtlsServer,
+				Tenants: []Tenant{
+					{
+						Authentication: "mtls",
+						ID:             "orgid",
+						MTLS:           tc.mtls,
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest("GET", "https://localhost", nil)
+			if tc.cert != nil {
+				req.TLS.PeerCertificates = []*x509.Certificate{tc.cert}
+				if tc.verified {
+					req.TLS.VerifiedChains = [][]*x509.Certificate{{tc.cert}}
+				}
+			} else {
+				req.TLS = &tls.ConnectionState{}
+			}
+			rw := httptest.NewRecorder()
+
+			var orgID string
+			auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				orgID = r.Header.Get("X-Scope-OrgID")
+			})).ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedStatus, rw.Code)
+			if tc.expectedStatus == http.StatusOK {
+				assert.Equal(t, "orgid", orgID)
+			}
+		})
+	}
+}
+
+func TestInvalidMTLSConfig(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config Config
+	}{
+		{
+			name: "server without TLS",
+			config: Config{
+				Tenants: []Tenant{{Authentication: "mtls", ID: "orgid", MTLS: MTLSConfig{Fingerprint: "00"}}},
+			},
+		},
+		{
+			name: "subject CN without a client CA",
+			config: Config{
+				Server:  ServerConfig{TLS: TLSConfig{CertFile: "server.pem", KeyFile: "server-key.pem"}},
+				Tenants: []Tenant{{Authentication: "mtls", ID: "orgid", MTLS: MTLSConfig{SubjectCN: "cluster-a"}}},
+			},
+		},
+		{
+			name: "URI SAN without a client CA",
+			config: Config{
+				Server:  ServerConfig{TLS: TLSConfig{CertFile: "server.pem", KeyFile: "server-key.pem"}},
+				Tenants: []Tenant{{Authentication: "mtls", ID: "orgid", MTLS: MTLSConfig{URISAN: "spiffe://example.com/cluster-a"}}},
+			},
+		},
+		{
+			name: "admin server TLS",
+			config: Config{
+				Admin: ServerConfig{TLS: TLSConfig{CertFile: "admin.pem", KeyFile: "admin-key.pem"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAuthentication(&tc.config)
+			assert.Error(t, err)
+		})
+	}
+
+	// a fingerprint pins the certificate without a client CA
+	_, err := NewAuthentication(&Config{
+		Server:  ServerConfig{TLS: TLSConfig{CertFile: "server.pem", KeyFile: "server-key.pem"}},
+		Tenants: []Tenant{{Authentication: "mtls", ID: "orgid", MTLS: MTLSConfig{Fingerprint: "00"}}},
+	})
+	assert.NoError(t, err)
+}
+
+func colonSeparated(s string) string {
+	var parts []string
+	for i := 0; i < len(s); i += 2 {
+		parts = append(parts, s[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
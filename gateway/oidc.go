@@ -0,0 +1,198 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultJWKSRefreshInterval = 10 * time.Minute
+	// unknown key IDs trigger an immediate refresh at most this often
+	defaultJWKSMinRefreshInterval = 30 * time.Second
+	// discovery and the JWKS are retried this often until the keys are loaded
+	oidcRetryInterval     = 10 * time.Second
+	oidcHTTPClientTimeout = 10 * time.Second
+)
+
+type oidcKeySet struct {
+	issuerURL string
+	// set once discovery succeeded, guarded by refreshMutex
+	jwksURL            string
+	client             *http.Client
+	keys               staticKeySet
+	lastAttempt        time.Time
+	minRefreshInterval time.Duration
+	refreshMutex       sync.Mutex
+	sync.RWMutex
+}
+
+func newOIDCVerifier(config OIDCConfig) (*jwtVerifier, error) {
+	if config.IssuerURL == "" {
+		return nil, fmt.Errorf("oidc authentication requires an issuer_url")
+	}
+	// without an audience any token of the issuer, e.g. one minted for another client, would be accepted
+	if config.Audience == "" {
+		return nil, fmt.Errorf("oidc authentication requires an audience")
+	}
+
+	ks := &oidcKeySet{
+		issuerURL:          config.IssuerURL,
+		client:             &http.Client{Timeout: oidcHTTPClientTimeout},
+		minRefreshInterval: defaultJWKSMinRefreshInterval,
+	}
+	// an unavailable issuer must not keep the gateway from starting, its
+	// tokens are rejected until the keys could be loaded
+	if err := ks.refresh(); err != nil {
+		logrus.Errorf("failed to load the keys of %s, retrying every %v: %v", config.IssuerURL, oidcRetryInterval, err)
+	}
+
+	refreshInterval := config.JWKSRefreshInterval
+	if refreshInterval == 0 {
+		refreshInterval = defaultJWKSRefreshInterval
+	}
+	go ks.refreshPeriodically(refreshInterval)
+
+	return &jwtVerifier{
+		keys:          ks,
+		parser:        newJWTParser(oidcJWTAlgorithms, config.IssuerURL, config.Audience),
+		tenantIDClaim: config.TenantIDClaim,
+	}, nil
+}
+
+func discoverJWKSURL(client *http.Client, issuerURL string) (string, error) {
+	discoveryURL := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+	body, err := fetch(client, discoveryURL)
+	if err != nil {
+		return "", fmt.Errorf("fetching the OIDC discovery document: %v", err)
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(body, &discovery); err != nil {
+		return "", fmt.Errorf("parsing the OIDC discovery document: %v", err)
+	}
+	if discovery.Issuer != issuerURL {
+		return "", fmt.Errorf("OIDC issuer mismatch: configured %s, discovered %s", issuerURL, discovery.Issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return "", fmt.Errorf("OIDC discovery document for %s has no jwks_uri", issuerURL)
+	}
+	return discovery.JWKSURI, nil
+}
+
+func fetch(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (ks *oidcKeySet) refresh() error {
+	ks.refreshMutex.Lock()
+	defer ks.refreshMutex.Unlock()
+
+	return ks.load()
+}
+
+// refreshForKey reloads the keys unless another request already did so
+// recently, which keeps tokens with bogus key IDs from hammering the issuer.
+func (ks *oidcKeySet) refreshForKey(kid string) {
+	ks.refreshMutex.Lock()
+	defer ks.refreshMutex.Unlock()
+
+	ks.RLock()
+	known := kid != "" && ks.keys.hasKey(kid)
+	recent := time.Since(ks.lastAttempt) < ks.minRefreshInterval
+	ks.RUnlock()
+	if known || recent {
+		return
+	}
+
+	// the issuer may have rotated its keys since the last refresh
+	logrus.Debugf("unknown key ID %q, refreshing the JWKS", kid)
+	if err := ks.load(); err != nil {
+		logrus.Errorf("failed to refresh the JWKS: %v", err)
+	}
+}
+
+func (ks *oidcKeySet) load() error {
+	ks.Lock()
+	ks.lastAttempt = time.Now()
+	ks.Unlock()
+
+	if ks.jwksURL == "" {
+		jwksURL, err := discoverJWKSURL(ks.client, ks.issuerURL)
+		if err != nil {
+			return err
+		}
+		ks.jwksURL = jwksURL
+	}
+
+	body, err := fetch(ks.client, ks.jwksURL)
+	if err != nil {
+		return fmt.Errorf("fetching the JWKS: %v", err)
+	}
+	keys, err := parseJWKS(body, false)
+	if err != nil {
+		return fmt.Errorf("parsing the JWKS: %v", err)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("the JWKS at %s has no usable keys", ks.jwksURL)
+	}
+
+	ks.Lock()
+	ks.keys = keys
+	ks.Unlock()
+	return nil
+}
+
+// refreshPeriodically reloads the keys every refreshInterval, or more often
+// as long as none could be loaded yet.
+func (ks *oidcKeySet) refreshPeriodically(refreshInterval time.Duration) {
+	for {
+		interval := refreshInterval
+		if !ks.loaded() {
+			interval = min(refreshInterval, oidcRetryInterval)
+		}
+		time.Sleep(interval)
+		if err := ks.refresh(); err != nil {
+			logrus.Errorf("failed to refresh the JWKS, keeping the previous keys: %v", err)
+		}
+	}
+}
+
+func (ks *oidcKeySet) loaded() bool {
+	ks.RLock()
+	defer ks.RUnlock()
+	return len(ks.keys) > 0
+}
+
+func (ks *oidcKeySet) lookup(kid string) []interface{} {
+	ks.RLock()
+	keys := ks.keys
+	ks.RUnlock()
+
+	if len(keys) > 0 && (kid == "" || keys.hasKey(kid)) {
+		return keys.lookup(kid)
+	}
+	ks.refreshForKey(kid)
+
+	ks.RLock()
+	defer ks.RUnlock()
+	return ks.keys.lookup(kid)
+}
@@ -0,0 +1,312 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockIssuer struct {
+	server       *httptest.Server
+	jwksRequests atomic.Int32
+	keys         map[string]*rsa.PrivateKey
+	// published as a symmetric key next to the RSA keys when set
+	secret      []byte
+	unavailable atomic.Bool
+	sync.Mutex
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	issuer := &mockIssuer{keys: map[string]*rsa.PrivateKey{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		if issuer.unavailable.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer.server.URL,
+			"jwks_uri": issuer.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		issuer.jwksRequests.Add(1)
+		issuer.Lock()
+		defer issuer.Unlock()
+		var keys []map[string]string
+		for kid, key := range issuer.keys {
+			keys = append(keys, rsaJWK(kid, &key.PublicKey))
+		}
+		if issuer.secret != nil {
+			keys = append(keys, map[string]string{"kty": "oct", "kid": "hmac", "k": base64.RawURLEncoding.EncodeToString(issuer.secret)})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *mockIssuer) rotate(t *testing.T, kid string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	i.Lock()
+	defer i.Unlock()
+	i.keys = map[string]*rsa.PrivateKey{kid: key}
+	return key
+}
+
+func (i *mockIssuer) token(t *testing.T, kid string, key *rsa.PrivateKey) string {
+	return signJWT(t, jwt.SigningMethodRS256, kid, key, jwt.MapClaims{
+		"iss":    i.server.URL,
+		"aud":    "cortex",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"org_id": "team-a",
+	})
+}
+
+func oidcRequest(auth *Authentication, token string) (int, string) {
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rw := httptest.NewRecorder()
+
+	var orgID string
+	auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgID = r.Header.Get("X-Scope-OrgID")
+	})).ServeHTTP(rw, req)
+	return rw.Code, orgID
+}
+
+func TestOIDCAuthentication(t *testing.T) {
+	issuer := newMockIssuer(t)
+	key := issuer.rotate(t, "key-1")
+
+	auth, err := NewAuthentication(&Config{
+		Tenants: []Tenant{
+			{
+				Authentication: "oidc",
+				OIDC: OIDCConfig{
+					IssuerURL:     issuer.server.URL,
+					Audience:      "cortex",
+					TenantIDClaim: "org_id",
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	status, orgID := oidcRequest(auth, issuer.token(t, "key-1", key))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "team-a", orgID)
+
+	otherIssuer := newMockIssuer(t)
+	otherKey := otherIssuer.rotate(t, "key-1")
+	status, _ = oidcRequest(auth, otherIssuer.token(t, "key-1", otherKey))
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestOIDCIgnoresSymmetricKeys(t *testing.T) {
+	issuer := newMockIssuer(t)
+	key := issuer.rotate(t, "key-1")
+	issuer.Lock()
+	issuer.secret = []byte("0123456789abcdef0123456789abcdef")
+	issuer.Unlock()
+
+	verifier, err := newOIDCVerifier(OIDCConfig{
+		IssuerURL:     issuer.server.URL,
+		Audience:      "cortex",
+		TenantIDClaim: "org_id",
+	})
+	require.NoError(t, err)
+	ks := verifier.keys.(*oidcKeySet)
+	assert.False(t, ks.keys.hasKey("hmac"))
+	tenants := []Tenant{{Authentication: "oidc", jwtVerifier: verifier}}
+	auth := &Authentication{config: &Config{Tenants: tenants}, index: newCredentialIndex(tenants)}
+
+	status, _ := oidcRequest(auth, issuer.token(t, "key-1", key))
+	assert.Equal(t, http.StatusOK, status)
+
+	// anyone can fetch the published secret and sign their own tokens with it
+	claims := jwt.MapClaims{"iss": issuer.server.URL, "aud": "cortex", "exp": time.Now().Add(time.Hour).Unix(), "org_id": "team-b"}
+	for _, kid := range []string{"hmac", ""} {
+		status, _ = oidcRequest(auth, signJWT(t, jwt.SigningMethodHS256, kid, issuer.secret, claims))
+		assert.Equal(t, http.StatusUnauthorized, status)
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	issuer := newMockIssuer(t)
+	oldKey := issuer.rotate(t, "key-1")
+
+	verifier, err := newOIDCVerifier(OIDCConfig{
+		IssuerURL:     issuer.server.URL,
+		Audience:      "cortex",
+		TenantIDClaim: "org_id",
+	})
+	require.NoError(t, err)
+	ks := verifier.keys.(*oidcKeySet)
+	ks.minRefreshInterval = 0
+	tenants := []Tenant{{Authentication: "oidc", jwtVerifier: verifier}}
+	auth := &Authentication{config: &Config{Tenants: tenants}, index: newCredentialIndex(tenants)}
+
+	status, _ := oidcRequest(auth, issuer.token(t, "key-1", oldKey))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int32(1), issuer.jwksRequests.Load())
+
+	// a token signed with a key published after the last refresh triggers a reload
+	newKey := issuer.rotate(t, "key-2")
+	status, _ = oidcRequest(auth, issuer.token(t, "key-2", newKey))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int32(2), issuer.jwksRequests.Load())
+
+	// the retired key is gone after the reload
+	status, _ = oidcRequest(auth, issuer.token(t, "key-1", oldKey))
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// unknown key IDs do not refresh more often than the minimum interval
+	ks.minRefreshInterval = time.Hour
+	requests := issuer.jwksRequests.Load()
+	for i := 0; i < 5; i++ {
+		status, _ = oidcRequest(auth, issuer.token(t, "key-3", newKey))
+		assert.Equal(t, http.StatusUnauthorized, status)
+	}
+	assert.Equal(t, requests, issuer.jwksRequests.Load())
+}
+
+func TestOIDCPeriodicRefresh(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.rotate(t, "key-1")
+
+	verifier, err := newOIDCVerifier(OIDCConfig{
+		IssuerURL:           issuer.server.URL,
+		Audience:            "cortex",
+		JWKSRefreshInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	ks := verifier.keys.(*oidcKeySet)
+
+	issuer.rotate(t, "key-2")
+	assert.Eventually(t, func() bool {
+		ks.RLock()
+		defer ks.RUnlock()
+		return ks.keys.hasKey("key-2")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNewOIDCVerifier(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.rotate(t, "key-1")
+
+	mismatch := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   "https://someone-else.example.com",
+			"jwks_uri": issuer.server.URL + "/keys",
+		})
+	}))
+	defer mismatch.Close()
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	testCases := []struct {
+		name       string
+		issuerURL  string
+		audience   string
+		expectErr  bool
+		expectKeys bool
+	}{
+		{
+			name:      "missing issuer",
+			issuerURL: "",
+			audience:  "cortex",
+			expectErr: true,
+		},
+		{
+			name:      "missing audience",
+			issuerURL: issuer.server.URL,
+			audience:  "",
+			expectErr: true,
+		},
+		{
+			name:       "issuer mismatch",
+			issuerURL:  mismatch.URL,
+			audience:   "cortex",
+			expectKeys: false,
+		},
+		{
+			name:       "unavailable issuer",
+			issuerURL:  unavailable.URL,
+			audience:   "cortex",
+			expectKeys: false,
+		},
+		{
+			name:       "valid issuer",
+			issuerURL:  issuer.server.URL,
+			audience:   "cortex",
+			expectKeys: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			verifier, err := newOIDCVerifier(OIDCConfig{IssuerURL: tc.issuerURL, Audience: tc.audience})
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectKeys, verifier.keys.(*oidcKeySet).loaded())
+		})
+	}
+}
+
+func TestOIDCUnavailableIssuer(t *testing.T) {
+	issuer := newMockIssuer(t)
+	key := issuer.rotate(t, "key-1")
+	issuer.unavailable.Store(true)
+
+	auth, err := NewAuthentication(&Config{
+		Tenants: []Tenant{
+			{
+				Authentication: "oidc",
+				OIDC: OIDCConfig{
+					IssuerURL:     issuer.server.URL,
+					Audience:      "cortex",
+					TenantIDClaim: "org_id",
+				},
+			},
+			{Authentication: "basic", Username: "user", Password: "pass", ID: "team-b"},
+		},
+	})
+	require.NoError(t, err, "an unavailable issuer does not keep the gateway from starting")
+	ks := auth.config.Tenants[0].jwtVerifier.keys.(*oidcKeySet)
+	ks.minRefreshInterval = 0
+
+	status, _ := oidcRequest(auth, issuer.token(t, "key-1", key))
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	req.SetBasicAuth("user", "pass")
+	rw := httptest.NewRecorder()
+	auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	// the keys are loaded once the issuer is back
+	issuer.unavailable.Store(false)
+	status, orgID := oidcRequest(auth, issuer.token(t, "key-1", key))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "team-a", orgID)
+}
@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	reasonMissingOrgID    = "missing_org_id"
+	reasonOrgIDNotAllowed = "org_id_not_allowed"
+)
+
+func (tenant *Tenant) validateAllowedOrgIDs(patterns []string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	if !tenant.Passthrough {
+		return fmt.Errorf("allowed_org_ids requires passthrough")
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid allowed org ID %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// allowedOrgIDs returns the org ID patterns of the identity, falling back from
+// the credential to the tenant. No patterns means any org ID is allowed.
+func (id identity) allowedOrgIDs() []string {
+	if id.credential != nil && len(id.credential.AllowedOrgIDs) > 0 {
+		return id.credential.AllowedOrgIDs
+	}
+	return id.tenant.AllowedOrgIDs
+}
+
+// checkOrgIDs validates the X-Scope-OrgID header values a passthrough client
+// sent. A federated header is only allowed when each of its IDs is. It returns
+// the reason and a message when the values are rejected.
+func (id identity) checkOrgIDs(values []string) (string, string) {
+	if len(values) == 0 || values[0] == "" {
+		return reasonMissingOrgID, "the X-Scope-OrgID header is required"
+	}
+	if len(values) > 1 {
+		return reasonOrgIDNotAllowed, "only one X-Scope-OrgID header is allowed"
+	}
+
+	patterns := id.allowedOrgIDs()
+	if len(patterns) == 0 {
+		return "", ""
+	}
+	for _, orgID := range strings.Split(values[0], tenantIDSeparator) {
+		if !matchesAny(patterns, orgID) {
+			logrus.Warnf("tenant %s sent the disallowed org ID %q", id.tenant.ID, orgID)
+			return reasonOrgIDNotAllowed, fmt.Sprintf("org ID %q is not allowed", orgID)
+		}
+	}
+	return "", ""
+}
+
+func matchesAny(patterns []string, orgID string) bool {
+	if orgID == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, orgID); ok {
+			return true
+		}
+	}
+	return false
+}
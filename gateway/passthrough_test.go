@@ -0,0 +1,154 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPassthroughOrgIDs(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication: "basic",
+			Passthrough:    true,
+			AllowedOrgIDs:  []string{"team-*"},
+			Credentials: []Credential{
+				{Username: "ops", Password: "ops", AllowedOrgIDs: []string{"ops", "staging-*"}},
+				{Username: "team", Password: "team"},
+			},
+		},
+		{Authentication: "bearer", Token: "any", Passthrough: true},
+		{Authentication: "bearer", Token: "fixed", ID: "fixed"},
+	}})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		setAuth        func(r *http.Request)
+		orgIDs         []string
+		expectedStatus int
+		expectedReason string
+		expectedOrgIDs []string
+	}{
+		{
+			name:           "org ID allowed for the credential",
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("ops", "ops") },
+			orgIDs:         []string{"staging-eu"},
+			expectedStatus: http.StatusOK,
+			expectedOrgIDs: []string{"staging-eu"},
+		},
+		{
+			name:           "credential patterns replace the tenant patterns",
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("ops", "ops") },
+			orgIDs:         []string{"team-a"},
+			expectedStatus: http.StatusForbidden,
+			expectedReason: reasonOrgIDNotAllowed,
+		},
+		{
+			name:           "org ID allowed for the tenant",
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("team", "team") },
+			orgIDs:         []string{"team-a"},
+			expectedStatus: http.StatusOK,
+			expectedOrgIDs: []string{"team-a"},
+		},
+		{
+			name:           "federated org IDs all allowed",
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("team", "team") },
+			orgIDs:         []string{"team-a|team-b"},
+			expectedStatus: http.StatusOK,
+			expectedOrgIDs: []string{"team-a|team-b"},
+		},
+		{
+			name:           "federated org IDs with a disallowed one",
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("team", "team") },
+			orgIDs:         []string{"team-a|ops"},
+			expectedStatus: http.StatusForbidden,
+			expectedReason: reasonOrgIDNotAllowed,
+		},
+		{
+			name:           "missing org ID",
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("team", "team") },
+			expectedStatus: http.StatusForbidden,
+			expectedReason: reasonMissingOrgID,
+		},
+		{
+			name:           "several org ID headers",
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("team", "team") },
+			orgIDs:         []string{"team-a", "team-b"},
+			expectedStatus: http.StatusForbidden,
+			expectedReason: reasonOrgIDNotAllowed,
+		},
+		{
+			name:           "unrestricted passthrough",
+			setAuth:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer any") },
+			orgIDs:         []string{"anything"},
+			expectedStatus: http.StatusOK,
+			expectedOrgIDs: []string{"anything"},
+		},
+		{
+			name:           "unrestricted passthrough still requires an org ID",
+			setAuth:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer any") },
+			expectedStatus: http.StatusForbidden,
+			expectedReason: reasonMissingOrgID,
+		},
+		{
+			name:           "incoming org IDs are stripped for other tenants",
+			setAuth:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer fixed") },
+			orgIDs:         []string{"victim", "other"},
+			expectedStatus: http.StatusOK,
+			expectedOrgIDs: []string{"fixed"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost", nil)
+			tc.setAuth(req)
+			for _, orgID := range tc.orgIDs {
+				req.Header.Add("X-Scope-OrgID", orgID)
+			}
+			rw := httptest.NewRecorder()
+			var orgIDs []string
+			auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				orgIDs = r.Header.Values("X-Scope-OrgID")
+			})).ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedStatus, rw.Code)
+			assert.Equal(t, tc.expectedOrgIDs, orgIDs)
+			if tc.expectedReason != "" {
+				var body denial
+				require.NoError(t, json.NewDecoder(rw.Body).Decode(&body))
+				assert.Equal(t, tc.expectedReason, body.Reason)
+			}
+		})
+	}
+}
+
+func TestInvalidAllowedOrgIDs(t *testing.T) {
+	testCases := []struct {
+		name   string
+		tenant Tenant
+	}{
+		{
+			name:   "without passthrough",
+			tenant: Tenant{Authentication: "bearer", Token: "token", ID: "orgid", AllowedOrgIDs: []string{"team-*"}},
+		},
+		{
+			name: "invalid pattern",
+			tenant: Tenant{Authentication: "bearer", Passthrough: true, Credentials: []Credential{
+				{Token: "token", AllowedOrgIDs: []string{"team-["}},
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAuthentication(&Config{Tenants: []Tenant{tc.tenant}})
+			assert.Error(t, err)
+		})
+	}
+}
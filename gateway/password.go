@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	verificationCacheTTL        = 5 * time.Minute
+	verificationCacheMaxEntries = 10000
+)
+
+func loadHtpasswd(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		username, hash, found := strings.Cut(line, ":")
+		if !found || username == "" || hash == "" {
+			return nil, fmt.Errorf("%s:%d: malformed htpasswd entry", path, lineNumber)
+		}
+		hashes[username] = hash
+	}
+	return hashes, scanner.Err()
+}
+
+func validateHash(hash string) error {
+	switch {
+	case isBcryptHash(hash):
+		_, err := bcrypt.Cost([]byte(hash))
+		return err
+	case strings.HasPrefix(hash, "$argon2id$"):
+		_, err := parseArgon2idHash(hash)
+		return err
+	default:
+		return fmt.Errorf("unsupported password hash, only bcrypt and argon2id are supported")
+	}
+}
+
+func verifyHash(hash, password string) bool {
+	if isBcryptHash(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	params, err := parseArgon2idHash(hash)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+type argon2idParams struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2idHash parses the PHC string format, e.g.
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func parseArgon2idHash(hash string) (argon2idParams, error) {
+	var params argon2idParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, fmt.Errorf("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, fmt.Errorf("malformed argon2id version: %v", err)
+	}
+	if version != argon2.Version {
+		return params, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, fmt.Errorf("malformed argon2id parameters: %v", err)
+	}
+	if params.time == 0 || params.threads == 0 {
+		return params, fmt.Errorf("invalid argon2id parameters")
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, fmt.Errorf("malformed argon2id salt: %v", err)
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return params, fmt.Errorf("malformed argon2id key: %v", err)
+	}
+	if len(params.key) == 0 {
+		return params, fmt.Errorf("empty argon2id key")
+	}
+	return params, nil
+}
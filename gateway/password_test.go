@@ -0,0 +1,197 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func bcryptHash(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return string(hash)
+}
+
+func argon2idHash(password string) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, 1, 1024, 1, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func writeHtpasswd(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestHashedPasswordAuthentication(t *testing.T) {
+	htpasswd := writeHtpasswd(t, "# team a\n"+
+		"alice:"+bcryptHash(t, "alice-password")+"\n"+
+		"\n"+
+		"bob:"+argon2idHash("bob-password")+"\n")
+
+	testCases := []struct {
+		name           string
+		tenant         Tenant
+		username       string
+		password       string
+		expectedStatus int
+	}{
+		{
+			name:           "valid bcrypt password_hash",
+			tenant:         Tenant{Authentication: "basic", Username: "user", PasswordHash: bcryptHash(t, "secret"), ID: "orgid"},
+			username:       "user",
+			password:       "secret",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong password for bcrypt password_hash",
+			tenant:         Tenant{Authentication: "basic", Username: "user", PasswordHash: bcryptHash(t, "secret"), ID: "orgid"},
+			username:       "user",
+			password:       "wrong",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "valid argon2id password_hash",
+			tenant:         Tenant{Authentication: "basic", Username: "user", PasswordHash: argon2idHash("secret"), ID: "orgid"},
+			username:       "user",
+			password:       "secret",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong password for argon2id password_hash",
+			tenant:         Tenant{Authentication: "basic", Username: "user", PasswordHash: argon2idHash("secret"), ID: "orgid"},
+			username:       "user",
+			password:       "wrong",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "the hash itself is not a valid password",
+			tenant:         Tenant{Authentication: "basic", Username: "user", PasswordHash: argon2idHash("secret"), ID: "orgid"},
+			username:       "user",
+			password:       argon2idHash("secret"),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "htpasswd bcrypt entry",
+			tenant:         Tenant{Authentication: "basic", HtpasswdFile: htpasswd, ID: "orgid"},
+			username:       "alice",
+			password:       "alice-password",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "htpasswd argon2id entry",
+			tenant:         Tenant{Authentication: "basic", HtpasswdFile: htpasswd, ID: "orgid"},
+			username:       "bob",
+			password:       "bob-password",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "htpasswd unknown user",
+			tenant:         Tenant{Authentication: "basic", HtpasswdFile: htpasswd, ID: "orgid"},
+			username:       "carol",
+			password:       "alice-password",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "htpasswd restricted to the tenant username",
+			tenant:         Tenant{Authentication: "basic", Username: "alice", HtpasswdFile: htpasswd, ID: "orgid"},
+			username:       "bob",
+			password:       "bob-password",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := NewAuthentication(&Config{Tenants: []Tenant{tc.tenant}})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest("GET", "http://localhost", nil)
+			req.SetBasicAuth(tc.username, tc.password)
+			rw := httptest.NewRecorder()
+
+			var orgID string
+			auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				orgID = r.Header.Get("X-Scope-OrgID")
+			})).ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedStatus, rw.Code)
+			if tc.expectedStatus == http.StatusOK {
+				assert.Equal(t, "orgid", orgID)
+			}
+		})
+	}
+}
+
+func TestInvalidPasswordConfig(t *testing.T) {
+	testCases := []struct {
+		name   string
+		tenant Tenant
+	}{
+		{
+			name:   "plaintext password combined with a hash",
+			tenant: Tenant{Username: "user", Password: "secret", PasswordHash: bcryptHash(t, "secret")},
+		},
+		{
+			name:   "password_hash without username",
+			tenant: Tenant{PasswordHash: bcryptHash(t, "secret")},
+		},
+		{
+			name:   "unsupported hash",
+			tenant: Tenant{Username: "user", PasswordHash: "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="},
+		},
+		{
+			name:   "malformed bcrypt hash",
+			tenant: Tenant{Username: "user", PasswordHash: "$2y$10$tooshort"},
+		},
+		{
+			name:   "malformed argon2id hash",
+			tenant: Tenant{Username: "user", PasswordHash: "$argon2id$v=19$m=1024$salt$key"},
+		},
+		{
+			name:   "missing htpasswd file",
+			tenant: Tenant{HtpasswdFile: "testdata/nonexistent"},
+		},
+		{
+			name:   "malformed htpasswd file",
+			tenant: Tenant{HtpasswdFile: writeHtpasswd(t, "alice\n")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.tenant.Authentication = "basic"
+			_, err := NewAuthentication(&Config{Tenants: []Tenant{tc.tenant}})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPasswordVerificationCache(t *testing.T) {
+	tenant := &Tenant{Authentication: "basic", Username: "user", PasswordHash: bcryptHash(t, "secret")}
+	require.NoError(t, tenant.initCredentials())
+	credential := &tenant.credentials[0]
+
+	assert.False(t, tenant.verifyPassword(credential, "wrong"))
+	assert.Equal(t, 0, tenant.verifications.len(), "failed verifications must not be cached")
+
+	assert.True(t, tenant.verifyPassword(credential, "secret"))
+	assert.Equal(t, 1, tenant.verifications.len())
+
+	// a cached entry is served without recomputing the hash
+	credential.PasswordHash = "$2y$10$invalid"
+	tenant.verifications.set(newCacheKey("user", "$2y$10$invalid", "secret"), struct{}{}, time.Now().Add(time.Minute))
+	assert.True(t, tenant.verifyPassword(credential, "secret"))
+}
@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// maxFormSize matches the limit net/http applies when parsing form bodies.
+const maxFormSize = 10 << 20
+
+// hasFormBody reports whether the request carries parameters in a form
+// encoded body, which the Prometheus API accepts for POST requests. Any other
+// body is an error, since Cortex may still read parameters from it, e.g. from
+// a multipart form, which would bypass the checks and rewrites of the gateway.
+func hasFormBody(r *http.Request) (bool, error) {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return false, nil
+	}
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Method != http.MethodPost || contentType != "application/x-www-form-urlencoded" {
+		return false, fmt.Errorf("unsupported %s request body of type %q", r.Method, r.Header.Get("Content-Type"))
+	}
+	return true, nil
+}
+
+func isFormRequest(r *http.Request) bool {
+	ok, err := hasFormBody(r)
+	return ok && err == nil
+}
+
+// queryParams returns the parameters of the request like
+// http.Request.ParseForm, with body parameters before URL parameters, but
+// leaves a body the proxy can forward.
+func queryParams(r *http.Request) (url.Values, error) {
+	params := r.URL.Query()
+	if ok, err := hasFormBody(r); !ok {
+		return params, err
+	}
+	body, err := readFormBody(r)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range params {
+		form[name] = append(form[name], values...)
+	}
+	return form, nil
+}
+
+// rewriteParams passes the URL parameters and, for form requests, the body
+// parameters to rewrite, and encodes the result back into the request.
+func rewriteParams(r *http.Request, rewrite func(url.Values) error) error {
+	hasForm, err := hasFormBody(r)
+	if err != nil {
+		return err
+	}
+	query := r.URL.Query()
+	if err := rewrite(query); err != nil {
+		return err
+	}
+	r.URL.RawQuery = query.Encode()
+
+	if !hasForm {
+		return nil
+	}
+	body, err := readFormBody(r)
+	if err != nil {
+		return err
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return err
+	}
+	if err := rewrite(form); err != nil {
+		return err
+	}
+	body = []byte(form.Encode())
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return nil
+}
+
+func readFormBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxFormSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxFormSize {
+		return nil, fmt.Errorf("the form body exceeds %d bytes", maxFormSize)
+	}
+	return body, nil
+}
@@ -0,0 +1,187 @@
+package gateway
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/sirupsen/logrus"
+)
+
+func (l QueryLimits) validate() error {
+	if l.MaxRange < 0 || l.MinStep < 0 || l.MaxPointsPerSeries < 0 || l.MaxLookback < 0 {
+		return fmt.Errorf("query limits must not be negative")
+	}
+	return nil
+}
+
+func (l QueryLimits) enabled() bool {
+	return l.MaxRange > 0 || l.MinStep > 0 || l.MaxPointsPerSeries > 0 || l.MaxLookback > 0
+}
+
+// limitQueries rejects instant and range queries that exceed the query limits
+// of the tenant with a 400, before they reach the query frontend.
+func limitQueries(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := identityFrom(r.Context())
+		if !ok || !id.tenant.QueryLimits.enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var err error
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/api/v1/query"):
+			err = id.tenant.QueryLimits.checkInstantQuery(r, time.Now())
+		case strings.HasSuffix(r.URL.Path, "/api/v1/query_range"):
+			err = id.tenant.QueryLimits.checkRangeQuery(r, time.Now())
+		}
+		if err != nil {
+			logrus.Debugf("rejecting a query of tenant %s: %v", id.tenant.ID, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l QueryLimits) checkInstantQuery(r *http.Request, now time.Time) error {
+	params, err := queryParams(r)
+	if err != nil {
+		return err
+	}
+	ts := now
+	if value := params.Get("time"); value != "" {
+		if ts, err = parseTime(value); err != nil {
+			return fmt.Errorf("invalid time %q: %v", value, err)
+		}
+	}
+	return l.checkLookback(params.Get("query"), ts, ts, now)
+}
+
+func (l QueryLimits) checkRangeQuery(r *http.Request, now time.Time) error {
+	params, err := queryParams(r)
+	if err != nil {
+		return err
+	}
+	start, err := parseTime(params.Get("start"))
+	if err != nil {
+		return fmt.Errorf("invalid start %q: %v", params.Get("start"), err)
+	}
+	end, err := parseTime(params.Get("end"))
+	if err != nil {
+		return fmt.Errorf("invalid end %q: %v", params.Get("end"), err)
+	}
+	step, err := parseDuration(params.Get("step"))
+	if err != nil || step <= 0 {
+		return fmt.Errorf("invalid step %q", params.Get("step"))
+	}
+
+	queryRange := end.Sub(start)
+	if l.MaxRange > 0 && queryRange > l.MaxRange {
+		return fmt.Errorf("the query range of %s exceeds the limit of %s", model.Duration(queryRange), model.Duration(l.MaxRange))
+	}
+	if l.MinStep > 0 && step < l.MinStep {
+		return fmt.Errorf("the step of %s is below the minimum of %s", model.Duration(step), model.Duration(l.MinStep))
+	}
+	if points := int64(queryRange/step) + 1; l.MaxPointsPerSeries > 0 && points > int64(l.MaxPointsPerSeries) {
+		return fmt.Errorf("the query returns %d points per series, the limit is %d, increase the step", points, l.MaxPointsPerSeries)
+	}
+	return l.checkLookback(params.Get("query"), start, end, now)
+}
+
+// checkLookback checks how far back the query reads samples when evaluated
+// from start to end.
+func (l QueryLimits) checkLookback(query string, start, end, now time.Time) error {
+	if l.MaxLookback == 0 {
+		return nil
+	}
+	earliest := start
+	if query != "" {
+		expr, err := parser.ParseExpr(query)
+		if err != nil {
+			return fmt.Errorf("invalid query %q: %v", query, err)
+		}
+		earliest = earliestRead(expr, start, end)
+	}
+	if now.Sub(earliest) > l.MaxLookback {
+		return fmt.Errorf("the query reaches %s back, the limit is %s", model.Duration(now.Sub(earliest)), model.Duration(l.MaxLookback))
+	}
+	return nil
+}
+
+// earliestRead returns the earliest time the expression reads samples from
+// when evaluated from start to end, taking the ranges, offsets and @
+// modifiers of its selectors and subqueries into account. The lookback of
+// instant vector selectors is left out.
+func earliestRead(expr parser.Expr, start, end time.Time) time.Time {
+	earliest := start
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		selector, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		t := start
+		for _, n := range path {
+			if subquery, ok := n.(*parser.SubqueryExpr); ok {
+				t = evaluationTime(t, subquery.Timestamp, subquery.StartOrEnd, start, end).Add(-subquery.OriginalOffset - subquery.Range)
+			}
+		}
+		t = evaluationTime(t, selector.Timestamp, selector.StartOrEnd, start, end).Add(-selector.OriginalOffset)
+		if len(path) > 0 {
+			if matrix, ok := path[len(path)-1].(*parser.MatrixSelector); ok {
+				t = t.Add(-matrix.Range)
+			}
+		}
+		if t.Before(earliest) {
+			earliest = t
+		}
+		return nil
+	})
+	return earliest
+}
+
+// evaluationTime applies an @ modifier to the time an expression is
+// evaluated at.
+func evaluationTime(t time.Time, timestamp *int64, startOrEnd parser.ItemType, start, end time.Time) time.Time {
+	switch {
+	case timestamp != nil:
+		return time.UnixMilli(*timestamp)
+	case startOrEnd == parser.START:
+		return start
+	case startOrEnd == parser.END:
+		return end
+	}
+	return t
+}
+
+// parseTime parses a timestamp the way the Prometheus API does, as Unix
+// seconds or RFC 3339.
+func parseTime(s string) (time.Time, error) {
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return time.Time{}, fmt.Errorf("not a finite timestamp")
+		}
+		seconds, fraction := math.Modf(t)
+		return time.Unix(int64(seconds), int64(math.Round(fraction*1000))*int64(time.Millisecond)), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// parseDuration parses a duration the way the Prometheus API does, as seconds
+// or a Prometheus duration such as 5m.
+func parseDuration(s string) (time.Duration, error) {
+	if d, err := strconv.ParseFloat(s, 64); err == nil {
+		if math.IsNaN(d) || math.IsInf(d, 0) || d > float64(math.MaxInt64)/float64(time.Second) {
+			return 0, fmt.Errorf("not a valid duration")
+		}
+		return time.Duration(d * float64(time.Second)), nil
+	}
+	d, err := model.ParseDuration(s)
+	return time.Duration(d), err
+}
@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitQueries(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication: "bearer",
+			Token:          "limited",
+			ID:             "limited",
+			QueryLimits: QueryLimits{
+				MaxRange:           7 * 24 * time.Hour,
+				MinStep:            15 * time.Second,
+				MaxPointsPerSeries: 11000,
+				MaxLookback:        30 * 24 * time.Hour,
+			},
+		},
+		{Authentication: "bearer", Token: "unlimited", ID: "unlimited"},
+	}})
+	require.NoError(t, err)
+
+	var forwardedBody string
+	handler := auth.Wrap(limitQueries(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwardedBody = string(body)
+	})))
+
+	now := time.Now()
+	unix := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(-d).Unix(), 10)
+	}
+	rfc3339 := func(d time.Duration) string {
+		return now.Add(-d).UTC().Format(time.RFC3339)
+	}
+
+	testCases := []struct {
+		name   string
+		token  string
+		path   string
+		params string
+		form   bool
+		error  string
+	}{
+		{name: "instant query", token: "limited", path: "/prometheus/api/v1/query", params: "query=up"},
+		{name: "instant query in range", token: "limited", path: "/api/prom/api/v1/query", params: "query=up&time=" + unix(24*time.Hour)},
+		{name: "instant query too far back", token: "limited", path: "/prometheus/api/v1/query", params: "query=up&time=" + rfc3339(90*24*time.Hour), error: "the query reaches"},
+		{name: "range selector in range", token: "limited", path: "/prometheus/api/v1/query", params: "query=" + url.QueryEscape("rate(up[7d])")},
+		{name: "range selector too far back", token: "limited", path: "/prometheus/api/v1/query", params: "query=" + url.QueryEscape("rate(up[90d])"), error: "the query reaches"},
+		{name: "offset too far back", token: "limited", path: "/prometheus/api/v1/query", params: "query=" + url.QueryEscape("up offset 60d"), error: "the query reaches"},
+		{name: "@ too far back", token: "limited", path: "/prometheus/api/v1/query", params: "query=" + url.QueryEscape("up @ "+unix(60*24*time.Hour)), error: "the query reaches"},
+		{name: "subquery too far back", token: "limited", path: "/prometheus/api/v1/query", params: "query=" + url.QueryEscape("max_over_time(up[1h:5m] offset 40d)"), error: "the query reaches"},
+		{name: "range query", token: "limited", path: "/prometheus/api/v1/query_range", params: "query=up&start=" + unix(24*time.Hour) + "&end=" + unix(0) + "&step=15s"},
+		{name: "form range query", token: "limited", path: "/api/prom/api/v1/query_range", params: "query=up&start=" + rfc3339(24*time.Hour) + "&end=" + rfc3339(0) + "&step=60", form: true},
+		{name: "range too long", token: "limited", path: "/prometheus/api/v1/query_range", params: "query=up&start=" + unix(8*24*time.Hour) + "&end=" + unix(0) + "&step=1h", error: "exceeds the limit of 1w"},
+		{name: "step too small", token: "limited", path: "/prometheus/api/v1/query_range", params: "query=up&start=" + unix(time.Hour) + "&end=" + unix(0) + "&step=5", error: "below the minimum of 15s"},
+		{name: "too many points", token: "limited", path: "/prometheus/api/v1/query_range", params: "query=up&start=" + unix(7*24*time.Hour) + "&end=" + unix(0) + "&step=15s", error: "points per series"},
+		{name: "form range too far back", token: "limited", path: "/prometheus/api/v1/query_range", params: "query=up&start=" + unix(60*24*time.Hour) + "&end=" + unix(55*24*time.Hour) + "&step=1h", form: true, error: "the query reaches"},
+		{name: "invalid step", token: "limited", path: "/prometheus/api/v1/query_range", params: "query=up&start=" + unix(time.Hour) + "&end=" + unix(0) + "&step=0", error: "invalid step"},
+		{name: "invalid start", token: "limited", path: "/prometheus/api/v1/query_range", params: "query=up&start=yesterday&end=" + unix(0) + "&step=15", error: "invalid start"},
+		{name: "other paths", token: "limited", path: "/prometheus/api/v1/series", params: "match[]=up&start=0"},
+		{name: "unlimited tenant", token: "unlimited", path: "/prometheus/api/v1/query_range", params: "query=up&start=0&end=" + unix(0) + "&step=1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			forwardedBody = ""
+			var req *http.Request
+			if tc.form {
+				req = httptest.NewRequest("POST", "http://localhost"+tc.path, strings.NewReader(tc.params))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest("GET", "http://localhost"+tc.path+"?"+tc.params, nil)
+			}
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if tc.error == "" {
+				assert.Equal(t, http.StatusOK, rw.Code, rw.Body.String())
+				if tc.form {
+					assert.Equal(t, tc.params, forwardedBody)
+				}
+			} else {
+				assert.Equal(t, http.StatusBadRequest, rw.Code)
+				assert.Contains(t, rw.Body.String(), tc.error)
+			}
+		})
+	}
+}
+
+func TestEarliestRead(t *testing.T) {
+	start := time.Unix(100000, 0)
+	end := time.Unix(200000, 0)
+	testCases := []struct {
+		query    string
+		earliest int64
+	}{
+		{query: `up`, earliest: 100000},
+		{query: `rate(up[1h])`, earliest: 100000 - 3600},
+		{query: `up offset 1h + up offset -1h`, earliest: 100000 - 3600},
+		{query: `rate(up[1h] @ 50000)`, earliest: 50000 - 3600},
+		{query: `up @ end() offset 1000s`, earliest: 100000},
+		{query: `up @ end() offset 150000s`, earliest: 50000},
+		{query: `max_over_time(rate(up[5m])[1h:1m] offset 1h)`, earliest: 100000 - 3600 - 3600 - 300},
+		{query: `max_over_time(up[1h:] @ 10000)`, earliest: 10000 - 3600},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tc.query)
+			require.NoError(t, err)
+			assert.Equal(t, tc.earliest, earliestRead(expr, start, end).Unix())
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	ts, err := parseTime("1700000000.5")
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000, 500*int64(time.Millisecond)), ts)
+
+	ts, err = parseTime("2023-11-14T22:13:20Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000000), ts.Unix())
+
+	_, err = parseTime("NaN")
+	assert.Error(t, err)
+	_, err = parseTime("")
+	assert.Error(t, err)
+}
+
+func TestParseDuration(t *testing.T) {
+	d, err := parseDuration("1.5")
+	require.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, d)
+
+	d, err = parseDuration("5m")
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, d)
+
+	_, err = parseDuration("1e300")
+	assert.Error(t, err)
+}
+
+func TestInvalidQueryLimits(t *testing.T) {
+	_, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{Authentication: "bearer", Token: "token", ID: "tenant", QueryLimits: QueryLimits{MinStep: -time.Second}},
+	}})
+	assert.Error(t, err)
+}
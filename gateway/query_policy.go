@@ -0,0 +1,192 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultLookback is how far back Prometheus looks for the sample of an
+	// instant vector selector.
+	defaultLookback = 5 * time.Minute
+	// defaultSubqueryStep is used for subqueries without a step, which Cortex
+	// evaluates at the default evaluation interval.
+	defaultSubqueryStep = time.Minute
+)
+
+func (p QueryPolicy) validate() error {
+	for _, name := range p.DeniedFunctions {
+		if _, ok := parser.Functions[name]; !ok {
+			return fmt.Errorf("unknown function %q in denied_functions", name)
+		}
+	}
+	if p.MaxCost < 0 {
+		return fmt.Errorf("max_cost must not be negative")
+	}
+	return nil
+}
+
+func (p QueryPolicy) enabled() bool {
+	return p.DenyRegexNameOnly || p.RequireEqualityMatcher || len(p.DeniedFunctions) > 0 || p.MaxCost > 0
+}
+
+// checkQueryPolicy rejects PromQL expressions and match[] selectors that
+// violate the query policy of the tenant with a 400 explaining the rule, so
+// that users fix their dashboards. It runs before the label matchers of the
+// tenant are added, so that only what the client sent is judged.
+func checkQueryPolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := identityFrom(r.Context())
+		// remote read requests carry matchers rather than PromQL
+		if !ok || !id.tenant.QueryPolicy.enabled() || strings.HasSuffix(r.URL.Path, "/read") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		params, err := queryParams(r)
+		if err == nil {
+			err = id.tenant.QueryPolicy.check(params, evaluations(r.URL.Path, params))
+		}
+		if err != nil {
+			logrus.Debugf("rejecting a query of tenant %s: %v", id.tenant.ID, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// evaluations returns the number of steps a range query is evaluated at, and
+// 1 for any other query.
+func evaluations(path string, params url.Values) float64 {
+	if !strings.HasSuffix(path, "/api/v1/query_range") {
+		return 1
+	}
+	start, err := parseTime(params.Get("start"))
+	if err != nil {
+		return 1
+	}
+	end, err := parseTime(params.Get("end"))
+	if err != nil {
+		return 1
+	}
+	step, err := parseDuration(params.Get("step"))
+	if err != nil || step <= 0 || end.Before(start) {
+		return 1
+	}
+	return float64(end.Sub(start)/step) + 1
+}
+
+func (p QueryPolicy) check(params url.Values, evaluations float64) error {
+	for _, query := range params["query"] {
+		expr, err := parser.ParseExpr(query)
+		if err != nil {
+			return fmt.Errorf("invalid query %q: %v", query, err)
+		}
+		if err := p.checkExpr(expr, evaluations); err != nil {
+			return err
+		}
+	}
+	for _, selector := range params["match[]"] {
+		matchers, err := parser.ParseMetricSelector(selector)
+		if err != nil {
+			return fmt.Errorf("invalid selector %q: %v", selector, err)
+		}
+		if err := p.checkSelector(&parser.VectorSelector{LabelMatchers: matchers}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p QueryPolicy) checkExpr(expr parser.Expr, evaluations float64) error {
+	cost := 0.0
+	err := parser.Walk(policyVisitor(func(node parser.Node, path []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.Call:
+			for _, denied := range p.DeniedFunctions {
+				if n.Func.Name == denied {
+					return fmt.Errorf("function %s is not allowed", denied)
+				}
+			}
+		case *parser.VectorSelector:
+			if err := p.checkSelector(n); err != nil {
+				return err
+			}
+			cost += selectorCost(path)
+		}
+		return nil
+	}), expr, nil)
+	if err != nil {
+		return err
+	}
+
+	cost *= evaluations
+	if p.MaxCost > 0 && cost > p.MaxCost {
+		return fmt.Errorf("the estimated cost of %.0f exceeds the limit of %.0f, narrow down the selectors, ranges or time range", cost, p.MaxCost)
+	}
+	return nil
+}
+
+func (p QueryPolicy) checkSelector(selector *parser.VectorSelector) error {
+	nameRegexOnly := len(selector.LabelMatchers) > 0
+	hasEquality := false
+	for _, m := range selector.LabelMatchers {
+		if m.Name != labels.MetricName || m.Type != labels.MatchRegexp {
+			nameRegexOnly = false
+		}
+		if m.Type == labels.MatchEqual && m.Value != "" {
+			hasEquality = true
+		}
+	}
+
+	if p.DenyRegexNameOnly && nameRegexOnly {
+		return fmt.Errorf("selector %s only matches the metric name with a regular expression, add a label matcher", selector)
+	}
+	if p.RequireEqualityMatcher && !hasEquality {
+		return fmt.Errorf("selector %s has no equality matcher, add a metric name or a label=\"value\" matcher", selector)
+	}
+	return nil
+}
+
+// selectorCost estimates the cost of a selector per evaluation as the minutes
+// of samples it reads, multiplied by the steps of the subqueries around it.
+func selectorCost(path []parser.Node) float64 {
+	minutes := defaultLookback.Minutes()
+	if len(path) > 0 {
+		if matrix, ok := path[len(path)-1].(*parser.MatrixSelector); ok {
+			minutes = matrix.Range.Minutes()
+		}
+	}
+	for _, node := range path {
+		if subquery, ok := node.(*parser.SubqueryExpr); ok {
+			step := subquery.Step
+			if step <= 0 {
+				step = defaultSubqueryStep
+			}
+			minutes *= float64(subquery.Range / step)
+		}
+	}
+	return minutes
+}
+
+// policyVisitor adapts a function to parser.Visitor, stopping the walk at the
+// first error, unlike parser.Inspect which ignores them.
+type policyVisitor func(parser.Node, []parser.Node) error
+
+func (v policyVisitor) Visit(node parser.Node, path []parser.Node) (parser.Visitor, error) {
+	if node == nil {
+		return nil, nil
+	}
+	if err := v(node, path); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckQueryPolicy(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication: "bearer",
+			Token:          "strict",
+			ID:             "strict",
+			QueryPolicy: QueryPolicy{
+				DenyRegexNameOnly:      true,
+				RequireEqualityMatcher: true,
+				DeniedFunctions:        []string{"label_replace"},
+				MaxCost:                10000,
+			},
+		},
+		{Authentication: "bearer", Token: "lenient", ID: "lenient"},
+	}})
+	require.NoError(t, err)
+
+	handler := auth.Wrap(checkQueryPolicy(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	now := time.Now().Unix()
+	testCases := []struct {
+		name  string
+		token string
+		path  string
+		query url.Values
+		error string
+	}{
+		{name: "allowed", token: "strict", path: "/prometheus/api/v1/query", query: url.Values{"query": {`sum(rate(http_requests_total{job="api"}[5m]))`}}},
+		{name: "regex on name only", token: "strict", path: "/prometheus/api/v1/query", query: url.Values{"query": {`{__name__=~"http_.*"}`}}, error: "only matches the metric name with a regular expression"},
+		{name: "regex on name with a label", token: "strict", path: "/prometheus/api/v1/query", query: url.Values{"query": {`{__name__=~"http_.*",job="api"}`}}},
+		{name: "no equality matcher", token: "strict", path: "/prometheus/api/v1/query", query: url.Values{"query": {`count({job=~".+"})`}}, error: "has no equality matcher"},
+		{name: "no equality match selector", token: "strict", path: "/prometheus/api/v1/series", query: url.Values{"match[]": {"up", `{job!="api"}`}}, error: "has no equality matcher"},
+		{name: "denied function", token: "strict", path: "/prometheus/api/v1/query", query: url.Values{"query": {`label_replace(up, "instance", "$1", "pod", "(.*)")`}}, error: "function label_replace is not allowed"},
+		{name: "expensive range", token: "strict", path: "/prometheus/api/v1/query", query: url.Values{"query": {`rate(up[30d])`}}, error: "estimated cost of 43200 exceeds the limit of 10000"},
+		{name: "expensive subquery", token: "strict", path: "/prometheus/api/v1/query", query: url.Values{"query": {`max_over_time(rate(up[5m])[7d:])`}}, error: "estimated cost"},
+		{
+			name:  "expensive range query",
+			token: "strict",
+			path:  "/api/prom/api/v1/query_range",
+			query: url.Values{"query": {`up`}, "start": {strconv.FormatInt(now-7*24*3600, 10)}, "end": {strconv.FormatInt(now, 10)}, "step": {"60"}},
+			error: "estimated cost",
+		},
+		{
+			name:  "cheap range query",
+			token: "strict",
+			path:  "/api/prom/api/v1/query_range",
+			query: url.Values{"query": {`up`}, "start": {strconv.FormatInt(now-3600, 10)}, "end": {strconv.FormatInt(now, 10)}, "step": {"60"}},
+		},
+		{name: "invalid query", token: "strict", path: "/prometheus/api/v1/query", query: url.Values{"query": {`sum(`}}, error: "invalid query"},
+		{name: "no policy", token: "lenient", path: "/prometheus/api/v1/query", query: url.Values{"query": {`{__name__=~".+"}`}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path+"?"+tc.query.Encode(), nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if tc.error == "" {
+				assert.Equal(t, http.StatusOK, rw.Code, rw.Body.String())
+			} else {
+				assert.Equal(t, http.StatusBadRequest, rw.Code)
+				assert.Contains(t, rw.Body.String(), tc.error)
+			}
+		})
+	}
+}
+
+func TestSelectorCost(t *testing.T) {
+	testCases := []struct {
+		query string
+		cost  float64
+	}{
+		{query: `up`, cost: 5},
+		{query: `rate(up[1h])`, cost: 60},
+		{query: `up + rate(up[10m])`, cost: 15},
+		{query: `max_over_time(rate(up[5m])[1h:5m])`, cost: 60},
+		{query: `max_over_time(up[1h:])`, cost: 300},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tc.query)
+			require.NoError(t, err)
+			err = QueryPolicy{MaxCost: tc.cost}.checkExpr(expr, 1)
+			assert.NoError(t, err)
+			err = QueryPolicy{MaxCost: tc.cost - 1}.checkExpr(expr, 1)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestInvalidQueryPolicy(t *testing.T) {
+	for _, policy := range []QueryPolicy{{DeniedFunctions: []string{"no_such_function"}}, {MaxCost: -1}} {
+		_, err := NewAuthentication(&Config{Tenants: []Tenant{
+			{Authentication: "bearer", Token: "token", ID: "tenant", QueryPolicy: policy},
+		}})
+		assert.Error(t, err)
+	}
+}
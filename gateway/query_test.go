@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteParams(t *testing.T) {
+	upper := func(params url.Values) error {
+		for name, values := range params {
+			for i, value := range values {
+				params[name][i] = strings.ToUpper(value)
+			}
+		}
+		return nil
+	}
+
+	req := httptest.NewRequest("POST", "http://localhost/api/v1/query?a=url", strings.NewReader("b=form"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	require.NoError(t, rewriteParams(req, upper))
+	assert.Equal(t, "a=URL", req.URL.RawQuery)
+	body, _ := io.ReadAll(req.Body)
+	assert.Equal(t, "b=FORM", string(body))
+	assert.Equal(t, int64(6), req.ContentLength)
+
+	// other bodies cannot be checked and are rejected
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "http://localhost/api/v1/query?a=url", strings.NewReader("b=form")),
+		httptest.NewRequest("GET", "http://localhost/api/v1/query?a=url", strings.NewReader("b=form")),
+		httptest.NewRequest("PUT", "http://localhost/api/v1/query?a=url", strings.NewReader("b=form")),
+	} {
+		if req.Method != "POST" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		assert.Error(t, rewriteParams(req, upper))
+		_, err := queryParams(req)
+		assert.Error(t, err)
+	}
+
+	req = httptest.NewRequest("POST", "http://localhost/api/v1/query", strings.NewReader(strings.Repeat("a", maxFormSize+1)))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Error(t, rewriteParams(req, upper))
+}
+
+func TestQueryParams(t *testing.T) {
+	req := httptest.NewRequest("POST", "http://localhost/api/v1/query?query=url&time=1", strings.NewReader("query=form"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	params, err := queryParams(req)
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{"query": {"form", "url"}, "time": {"1"}}, params)
+
+	// the body is left for the proxy
+	body, _ := io.ReadAll(req.Body)
+	assert.Equal(t, "query=form", string(body))
+}
@@ -0,0 +1,156 @@
+package gateway
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rateLimiterMaxBuckets bounds the number of tenant IDs tracked per limiter,
+// which matters for passthrough tenants that choose their own IDs.
+const rateLimiterMaxBuckets = 100000
+
+func validateRateLimits(limits map[string]RateLimit) error {
+	for component, limit := range limits {
+		if _, ok := componentRoles[component]; !ok {
+			return fmt.Errorf("invalid rate limit component %q, valid options: %s, %s, %s, %s", component, DISTRIBUTOR, FRONTEND, ALERTMANAGER, RULER)
+		}
+		if limit.RequestsPerSecond <= 0 {
+			return fmt.Errorf("%s rate limit requires a positive requests_per_second", component)
+		}
+		if limit.Burst < 0 {
+			return fmt.Errorf("%s rate limit burst must not be negative", component)
+		}
+	}
+	return nil
+}
+
+// burst defaults to one second worth of requests.
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.RequestsPerSecond))
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	// when the bucket will have refilled completely
+	full time.Time
+}
+
+// take removes n tokens if there are enough. Otherwise it returns how long it
+// takes until enough tokens are available.
+func (b *tokenBucket) take(now time.Time, rate, burst, n float64) (bool, time.Duration) {
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	allowed := b.tokens >= n
+	if allowed {
+		b.tokens -= n
+	}
+	b.full = now.Add(seconds((burst - b.tokens) / rate))
+	if allowed {
+		return true, 0
+	}
+	return false, seconds((n - b.tokens) / rate)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// tokenBuckets holds a token bucket per key, created full on first use.
+type tokenBuckets struct {
+	buckets map[string]*tokenBucket
+	sync.Mutex
+}
+
+func newTokenBuckets() *tokenBuckets {
+	return &tokenBuckets{
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+func (t *tokenBuckets) take(key string, rate, burst, n float64) (bool, time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+	bucket, ok := t.buckets[key]
+	if !ok {
+		if len(t.buckets) >= rateLimiterMaxBuckets {
+			t.dropFullBuckets(now)
+		}
+		bucket = &tokenBucket{tokens: burst, last: now}
+		t.buckets[key] = bucket
+	}
+	return bucket.take(now, rate, burst, n)
+}
+
+// dropFullBuckets forgets the buckets that have refilled completely, since a
+// new bucket starts out full anyway.
+func (t *tokenBuckets) dropFullBuckets(now time.Time) {
+	for key, bucket := range t.buckets {
+		if !now.Before(bucket.full) {
+			delete(t.buckets, key)
+		}
+	}
+	if len(t.buckets) >= rateLimiterMaxBuckets {
+		t.buckets = map[string]*tokenBucket{}
+	}
+}
+
+// limitKey returns the key the limits of the request are tracked under: the
+// tenant ID forwarded to Cortex, so that tenant entries sharing an ID share
+// their limits. Passthrough tenants choose that ID themselves, so their limits
+// apply to the tenant entry as a whole, whichever org IDs it sends.
+func (id identity) limitKey(r *http.Request) string {
+	if id.tenant.Passthrough {
+		// the separator cannot occur in a single forwarded tenant ID
+		return fmt.Sprintf("passthrough%s%p", tenantIDSeparator, id.tenant)
+	}
+	return r.Header.Get("X-Scope-OrgID")
+}
+
+// RateLimiter applies the token bucket rate limits the authenticated tenant
+// configured for a component. Buckets are keyed by the identity's limitKey.
+type RateLimiter struct {
+	component string
+	buckets   *tokenBuckets
+}
+
+func NewRateLimiter(component string) *RateLimiter {
+	return &RateLimiter{
+		component: component,
+		buckets:   newTokenBuckets(),
+	}
+}
+
+func (l *RateLimiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := identityFrom(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limit, ok := id.tenant.RateLimits[l.component]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		orgID := r.Header.Get("X-Scope-OrgID")
+		if allowed, retryAfter := l.buckets.take(id.limitKey(r), limit.RequestsPerSecond, limit.burst(), 1); !allowed {
+			logrus.Debugf("tenant %s exceeded its %s rate limit", orgID, l.component)
+			w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,178 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/auth-gateway/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication: "bearer",
+			Token:          "noisy",
+			ID:             "noisy",
+			RateLimits: map[string]RateLimit{
+				DISTRIBUTOR: {RequestsPerSecond: 0.5, Burst: 2},
+			},
+		},
+		{
+			Authentication: "bearer",
+			Token:          "noisy-2",
+			ID:             "noisy",
+			RateLimits: map[string]RateLimit{
+				DISTRIBUTOR: {RequestsPerSecond: 0.5, Burst: 2},
+			},
+		},
+		{Authentication: "bearer", Token: "quiet", ID: "quiet"},
+	}})
+	require.NoError(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/push", NewRateLimiter(DISTRIBUTOR).Wrap(ok))
+	mux.Handle("/prometheus/api/v1/query", NewRateLimiter(FRONTEND).Wrap(ok))
+	handler := middleware.Merge(auth).Wrap(mux)
+
+	request := func(token, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	assert.Equal(t, http.StatusOK, request("noisy", "/api/v1/push").Code)
+	assert.Equal(t, http.StatusOK, request("noisy", "/api/v1/push").Code)
+
+	rw := request("noisy", "/api/v1/push")
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	retryAfter, err := strconv.Atoi(rw.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, 2, retryAfter, 1)
+
+	// tenant entries with the same ID share the bucket
+	assert.Equal(t, http.StatusTooManyRequests, request("noisy-2", "/api/v1/push").Code)
+	// components are limited separately
+	assert.Equal(t, http.StatusOK, request("noisy", "/prometheus/api/v1/query").Code)
+	// other tenants are not affected
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, http.StatusOK, request("quiet", "/api/v1/push").Code)
+	}
+}
+
+func TestRateLimiterPassthrough(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication: "bearer",
+			Token:          "passthrough",
+			Passthrough:    true,
+			RateLimits: map[string]RateLimit{
+				DISTRIBUTOR: {RequestsPerSecond: 0.5, Burst: 2},
+			},
+		},
+		{
+			Authentication: "bearer",
+			Token:          "other",
+			Passthrough:    true,
+			RateLimits: map[string]RateLimit{
+				DISTRIBUTOR: {RequestsPerSecond: 0.5, Burst: 2},
+			},
+		},
+	}})
+	require.NoError(t, err)
+	handler := middleware.Merge(auth).Wrap(NewRateLimiter(DISTRIBUTOR).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	request := func(token, orgID string) int {
+		req := httptest.NewRequest("POST", "http://localhost/api/v1/push", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Scope-OrgID", orgID)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	// a new org ID on every request does not get a new bucket
+	assert.Equal(t, http.StatusOK, request("passthrough", "team-1"))
+	assert.Equal(t, http.StatusOK, request("passthrough", "team-2"))
+	assert.Equal(t, http.StatusTooManyRequests, request("passthrough", "team-3"))
+	// passthrough tenant entries are limited separately, even with the same org ID
+	assert.Equal(t, http.StatusOK, request("other", "team-1"))
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	bucket := &tokenBucket{tokens: 3, last: now}
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := bucket.take(now, 10, 3, 1)
+		assert.True(t, allowed)
+	}
+	allowed, retryAfter := bucket.take(now, 10, 3, 1)
+	assert.False(t, allowed)
+	assert.InDelta(t, 100*time.Millisecond, retryAfter, float64(time.Millisecond))
+	assert.Equal(t, now.Add(300*time.Millisecond), bucket.full)
+
+	allowed, _ = bucket.take(now.Add(100*time.Millisecond), 10, 3, 1)
+	assert.True(t, allowed)
+
+	// refilling never exceeds the burst
+	allowed, _ = bucket.take(now.Add(time.Hour), 10, 3, 3)
+	assert.True(t, allowed)
+	allowed, retryAfter = bucket.take(now.Add(time.Hour), 10, 3, 2)
+	assert.False(t, allowed)
+	assert.InDelta(t, 200*time.Millisecond, retryAfter, float64(time.Millisecond))
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	assert.Equal(t, 5.0, RateLimit{RequestsPerSecond: 100, Burst: 5}.burst())
+	assert.Equal(t, 100.0, RateLimit{RequestsPerSecond: 100}.burst())
+	assert.Equal(t, 3.0, RateLimit{RequestsPerSecond: 2.5}.burst())
+	assert.Equal(t, 1.0, RateLimit{RequestsPerSecond: 0.1}.burst())
+}
+
+func TestTokenBucketsDropFullBuckets(t *testing.T) {
+	buckets := newTokenBuckets()
+	now := time.Now()
+	buckets.buckets["full"] = &tokenBucket{full: now.Add(-time.Second)}
+	buckets.buckets["refilling"] = &tokenBucket{full: now.Add(time.Second)}
+
+	buckets.dropFullBuckets(now)
+	assert.NotContains(t, buckets.buckets, "full")
+	assert.Contains(t, buckets.buckets, "refilling")
+}
+
+func TestInvalidRateLimits(t *testing.T) {
+	testCases := []struct {
+		name   string
+		limits map[string]RateLimit
+	}{
+		{
+			name:   "unknown component",
+			limits: map[string]RateLimit{"ingester": {RequestsPerSecond: 1}},
+		},
+		{
+			name:   "missing requests_per_second",
+			limits: map[string]RateLimit{DISTRIBUTOR: {Burst: 10}},
+		},
+		{
+			name:   "negative burst",
+			limits: map[string]RateLimit{FRONTEND: {RequestsPerSecond: 1, Burst: -1}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAuthentication(&Config{Tenants: []Tenant{
+				{Authentication: "bearer", Token: "token", ID: "orgid", RateLimits: tc.limits},
+			}})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// validateRelabelConfigs catches the entries that would make relabeling
+// panic. Everything else is validated when the configuration is parsed.
+func validateRelabelConfigs(cfgs []*relabel.Config) error {
+	for i, cfg := range cfgs {
+		if cfg == nil || cfg.Action == "" || cfg.Regex.Regexp == nil {
+			return fmt.Errorf("relabel config %d: an action and a regex are required", i)
+		}
+	}
+	return nil
+}
+
+// relabelWriteRequest applies the relabel configs to every series of the
+// request in place, and returns the number of series that were dropped.
+// Series left without any label are dropped as well.
+func relabelWriteRequest(req *prompb.WriteRequest, cfgs []*relabel.Config) int {
+	kept := req.Timeseries[:0]
+	for _, series := range req.Timeseries {
+		lbls := make([]labels.Label, 0, len(series.Labels))
+		for _, label := range series.Labels {
+			lbls = append(lbls, labels.Label{Name: label.Name, Value: label.Value})
+		}
+
+		relabeled, keep := relabel.Process(labels.New(lbls...), cfgs...)
+		if !keep || relabeled.IsEmpty() {
+			continue
+		}
+
+		series.Labels = series.Labels[:0]
+		relabeled.Range(func(label labels.Label) {
+			series.Labels = append(series.Labels, prompb.Label{Name: label.Name, Value: label.Value})
+		})
+		kept = append(kept, series)
+	}
+
+	dropped := len(req.Timeseries) - len(kept)
+	req.Timeseries = kept
+	return dropped
+}
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const relabelConfigs = `
+- action: labeldrop
+  regex: pod_template_hash
+- action: drop
+  source_labels: [__name__]
+  regex: go_.*
+- action: keep
+  source_labels: [env]
+  regex: prod|staging
+- action: replace
+  source_labels: [env]
+  regex: staging
+  target_label: env
+  replacement: stage
+`
+
+func TestRelabeling(t *testing.T) {
+	var cfgs []*relabel.Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(relabelConfigs), &cfgs))
+
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication:    "bearer",
+			Token:             "token",
+			ID:                "tenant",
+			RelabelConfigs:    cfgs,
+			RemoteWriteLimits: RemoteWriteLimits{MaxLabelNamesPerSeries: 3},
+		},
+	}})
+	require.NoError(t, err)
+
+	inspector := NewRemoteWriteInspector(prometheus.NewRegistry())
+	var forwarded *prompb.WriteRequest
+	handler := auth.Wrap(inspector.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, int64(len(body)), r.ContentLength)
+		forwarded = &prompb.WriteRequest{}
+		require.NoError(t, decodeProto(body, forwarded))
+	})))
+
+	// the limit on label names applies after pod_template_hash was dropped
+	body := encodeSeries(t,
+		newSeries("up", 1, "env", "prod", "pod", "a", "pod_template_hash", "123"),
+		newSeries("up", 1, "env", "staging", "pod", "b"),
+		newSeries("up", 1, "env", "dev", "pod", "c"),
+		newSeries("go_goroutines", 1, "env", "prod"),
+	)
+	req := httptest.NewRequest("POST", "http://localhost/api/v1/push", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	require.NotNil(t, forwarded)
+	assert.Equal(t, []prompb.TimeSeries{
+		newSeries("up", 1, "env", "prod", "pod", "a"),
+		newSeries("up", 1, "env", "stage", "pod", "b"),
+	}, forwarded.Timeseries)
+	assert.Equal(t, 2.0, testutil.ToFloat64(inspector.droppedSeries.WithLabelValues("tenant")))
+}
+
+func TestRelabelWriteRequestDropsEmptySeries(t *testing.T) {
+	cfgs := []*relabel.Config{{Action: relabel.LabelDrop, Regex: relabel.MustNewRegexp(".*")}}
+	req := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{newSeries("up", 1, "job", "api")}}
+	assert.Equal(t, 1, relabelWriteRequest(req, cfgs))
+	assert.Empty(t, req.Timeseries)
+}
+
+func TestInvalidRelabelConfigs(t *testing.T) {
+	var cfgs []*relabel.Config
+	assert.Error(t, yaml.UnmarshalStrict([]byte("- action: replace\n  regex: a\n"), &cfgs))
+
+	for _, cfgs := range [][]*relabel.Config{{nil}, {{Action: relabel.Drop}}} {
+		_, err := NewAuthentication(&Config{Tenants: []Tenant{
+			{Authentication: "bearer", Token: "token", ID: "tenant", RelabelConfigs: cfgs},
+		}})
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,260 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+)
+
+// maxDecodedSize guards against small snappy payloads that decompress to huge
+// ones.
+const maxDecodedSize = 128 << 20
+
+// maxEncodedSize is the largest snappy payload that can decode to at most
+// maxDecodedSize bytes.
+var maxEncodedSize = int64(snappy.MaxEncodedLen(maxDecodedSize))
+
+var errBodyTooLarge = fmt.Errorf("the request body exceeds %d bytes", maxEncodedSize)
+
+const (
+	reasonMalformed           = "malformed"
+	reasonSeriesPerRequest    = "max_series_per_request"
+	reasonSamplesPerRequest   = "max_samples_per_request"
+	reasonLabelNamesPerSeries = "max_label_names_per_series"
+	reasonLabelNameLength     = "max_label_name_length"
+	reasonLabelValueLength    = "max_label_value_length"
+	reasonMetricNameAllowed   = "allowed_metric_names"
+	reasonMetricNameDenied    = "denied_metric_names"
+)
+
+func (l *RemoteWriteLimits) init() error {
+	if l.MaxSeriesPerRequest < 0 || l.MaxSamplesPerRequest < 0 || l.MaxLabelNamesPerSeries < 0 ||
+		l.MaxLabelNameLength < 0 || l.MaxLabelValueLength < 0 {
+		return fmt.Errorf("remote write limits must not be negative")
+	}
+	var err error
+	if l.allowedMetricNames, err = compileAnchored(l.AllowedMetricNames); err != nil {
+		return fmt.Errorf("invalid allowed_metric_names: %v", err)
+	}
+	if l.deniedMetricNames, err = compileAnchored(l.DeniedMetricNames); err != nil {
+		return fmt.Errorf("invalid denied_metric_names: %v", err)
+	}
+	return nil
+}
+
+// compileAnchored compiles patterns that have to match the whole string, like
+// the regular expressions of Prometheus.
+func compileAnchored(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func (l *RemoteWriteLimits) enabled() bool {
+	return l.MaxSeriesPerRequest > 0 || l.MaxSamplesPerRequest > 0 || l.MaxLabelNamesPerSeries > 0 ||
+		l.MaxLabelNameLength > 0 || l.MaxLabelValueLength > 0 ||
+		len(l.allowedMetricNames) > 0 || len(l.deniedMetricNames) > 0
+}
+
+type limitError struct {
+	reason  string
+	message string
+}
+
+func (e *limitError) Error() string {
+	return e.message
+}
+
+// check returns the first limit the request exceeds.
+func (l *RemoteWriteLimits) check(req *prompb.WriteRequest) *limitError {
+	if l.MaxSeriesPerRequest > 0 && len(req.Timeseries) > l.MaxSeriesPerRequest {
+		return &limitError{reasonSeriesPerRequest, fmt.Sprintf("the request has %d series, the limit is %d", len(req.Timeseries), l.MaxSeriesPerRequest)}
+	}
+
+	samples := 0
+	for i := range req.Timeseries {
+		series := &req.Timeseries[i]
+		samples += len(series.Samples) + len(series.Histograms)
+		if err := l.checkSeries(series); err != nil {
+			return err
+		}
+	}
+	if l.MaxSamplesPerRequest > 0 && samples > l.MaxSamplesPerRequest {
+		return &limitError{reasonSamplesPerRequest, fmt.Sprintf("the request has %d samples, the limit is %d", samples, l.MaxSamplesPerRequest)}
+	}
+	return nil
+}
+
+func (l *RemoteWriteLimits) checkSeries(series *prompb.TimeSeries) *limitError {
+	metricName := ""
+	for _, label := range series.Labels {
+		if label.Name == "__name__" {
+			metricName = label.Value
+		}
+	}
+
+	if l.MaxLabelNamesPerSeries > 0 && len(series.Labels) > l.MaxLabelNamesPerSeries {
+		return &limitError{reasonLabelNamesPerSeries, fmt.Sprintf("series %s has %d labels, the limit is %d", metricName, len(series.Labels), l.MaxLabelNamesPerSeries)}
+	}
+	for _, label := range series.Labels {
+		if l.MaxLabelNameLength > 0 && len(label.Name) > l.MaxLabelNameLength {
+			return &limitError{reasonLabelNameLength, fmt.Sprintf("series %s has the label name %.64q longer than %d", metricName, label.Name, l.MaxLabelNameLength)}
+		}
+		if l.MaxLabelValueLength > 0 && len(label.Value) > l.MaxLabelValueLength {
+			return &limitError{reasonLabelValueLength, fmt.Sprintf("series %s has a value of label %s longer than %d", metricName, label.Name, l.MaxLabelValueLength)}
+		}
+	}
+
+	if len(l.allowedMetricNames) > 0 && !matchesRegexp(l.allowedMetricNames, metricName) {
+		return &limitError{reasonMetricNameAllowed, fmt.Sprintf("metric name %q is not allowed", metricName)}
+	}
+	if matchesRegexp(l.deniedMetricNames, metricName) {
+		return &limitError{reasonMetricNameDenied, fmt.Sprintf("metric name %q is denied", metricName)}
+	}
+	return nil
+}
+
+func matchesRegexp(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// protoMessage is a gogo protobuf message of the prompb package.
+type protoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+// readProtoBody reads a snappy compressed protobuf body, without buffering more
+// than could ever be decoded.
+func readProtoBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxEncodedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxEncodedSize {
+		return nil, errBodyTooLarge
+	}
+	return body, nil
+}
+
+// decodeProto decodes a snappy compressed protobuf body, as used by the remote
+// write and remote read protocols.
+func decodeProto(body []byte, msg protoMessage) error {
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return err
+	}
+	if size > maxDecodedSize {
+		return fmt.Errorf("the decompressed request of %d bytes exceeds %d bytes", size, maxDecodedSize)
+	}
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return err
+	}
+	return msg.Unmarshal(data)
+}
+
+func encodeProto(msg protoMessage) ([]byte, error) {
+	data, err := msg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return snappy.Encode(nil, data), nil
+}
+
+// RemoteWriteInspector decodes remote write requests, relabels their series
+// and rejects those that exceed the limits of the authenticated tenant with a
+// 400 explaining the limit, like Cortex does for requests that must not be
+// retried. Limits apply to the relabeled series.
+type RemoteWriteInspector struct {
+	rejectedSeries *prometheus.CounterVec
+	droppedSeries  *prometheus.CounterVec
+}
+
+func NewRemoteWriteInspector(reg prometheus.Registerer) *RemoteWriteInspector {
+	return &RemoteWriteInspector{
+		rejectedSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "gateway_remote_write_rejected_series_total",
+			Help:      "Series of remote write requests rejected because of the tenant's remote write limits.",
+		}, []string{"tenant", "reason"}),
+		droppedSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "gateway_remote_write_dropped_series_total",
+			Help:      "Series of remote write requests dropped by the tenant's relabel configs.",
+		}, []string{"tenant"}),
+	}
+}
+
+func (i *RemoteWriteInspector) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := identityFrom(r.Context())
+		if !ok || (len(id.tenant.RelabelConfigs) == 0 && !id.tenant.RemoteWriteLimits.enabled()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		orgID := r.Header.Get("X-Scope-OrgID")
+
+		body, err := readProtoBody(r)
+		if err == errBodyTooLarge {
+			logrus.Debugf("rejecting the remote write request of tenant %s: %v", orgID, err)
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			logrus.Debugf("reading the remote write request of tenant %s: %v", orgID, err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		req := &prompb.WriteRequest{}
+		if err := decodeProto(body, req); err != nil {
+			i.reject(w, orgID, &limitError{reasonMalformed, fmt.Sprintf("malformed remote write request: %v", err)}, 0)
+			return
+		}
+
+		if len(id.tenant.RelabelConfigs) > 0 {
+			dropped := relabelWriteRequest(req, id.tenant.RelabelConfigs)
+			i.droppedSeries.WithLabelValues(orgID).Add(float64(dropped))
+		}
+		if err := id.tenant.RemoteWriteLimits.check(req); err != nil {
+			i.reject(w, orgID, err, len(req.Timeseries))
+			return
+		}
+		if len(id.tenant.RelabelConfigs) > 0 {
+			if body, err = encodeProto(req); err != nil {
+				logrus.Errorf("encoding the relabeled remote write request of tenant %s: %v", orgID, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (i *RemoteWriteInspector) reject(w http.ResponseWriter, orgID string, err *limitError, series int) {
+	logrus.Debugf("rejecting a remote write request of tenant %s: %v", orgID, err)
+	i.rejectedSeries.WithLabelValues(orgID, err.reason).Add(float64(series))
+	http.Error(w, fmt.Sprintf("%s (%s)", err.message, err.reason), http.StatusBadRequest)
+}
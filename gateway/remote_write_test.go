@@ -0,0 +1,182 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSeries(name string, samples int, labels ...string) prompb.TimeSeries {
+	series := prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: name}}}
+	for i := 0; i+1 < len(labels); i += 2 {
+		series.Labels = append(series.Labels, prompb.Label{Name: labels[i], Value: labels[i+1]})
+	}
+	for i := 0; i < samples; i++ {
+		series.Samples = append(series.Samples, prompb.Sample{Value: float64(i), Timestamp: int64(i)})
+	}
+	return series
+}
+
+func encodeSeries(t *testing.T, series ...prompb.TimeSeries) []byte {
+	body, err := encodeProto(&prompb.WriteRequest{Timeseries: series})
+	require.NoError(t, err)
+	return body
+}
+
+func TestRemoteWriteInspector(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication: "bearer",
+			Token:          "limited",
+			ID:             "limited",
+			RemoteWriteLimits: RemoteWriteLimits{
+				MaxSeriesPerRequest:    3,
+				MaxSamplesPerRequest:   5,
+				MaxLabelNamesPerSeries: 3,
+				MaxLabelNameLength:     10,
+				MaxLabelValueLength:    20,
+				AllowedMetricNames:     []string{"up", "http_.*"},
+				DeniedMetricNames:      []string{"http_debug_.*"},
+			},
+		},
+		{Authentication: "bearer", Token: "unlimited", ID: "unlimited"},
+	}})
+	require.NoError(t, err)
+
+	inspector := NewRemoteWriteInspector(prometheus.NewRegistry())
+	var forwarded []byte
+	handler := auth.Wrap(inspector.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded, _ = io.ReadAll(r.Body)
+		assert.Equal(t, int64(len(forwarded)), r.ContentLength)
+	})))
+
+	push := func(token string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "http://localhost/api/v1/push", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	body := encodeSeries(t, newSeries("up", 2, "job", "api"), newSeries("http_requests_total", 3))
+	rw := push("limited", body)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, body, forwarded)
+
+	testCases := []struct {
+		name   string
+		series []prompb.TimeSeries
+		reason string
+	}{
+		{
+			name:   "too many series",
+			series: []prompb.TimeSeries{newSeries("up", 1), newSeries("up", 1), newSeries("up", 1), newSeries("up", 1)},
+			reason: reasonSeriesPerRequest,
+		},
+		{
+			name:   "too many samples",
+			series: []prompb.TimeSeries{newSeries("up", 3), newSeries("up", 3)},
+			reason: reasonSamplesPerRequest,
+		},
+		{
+			name:   "too many labels",
+			series: []prompb.TimeSeries{newSeries("up", 1, "a", "1", "b", "2", "c", "3")},
+			reason: reasonLabelNamesPerSeries,
+		},
+		{
+			name:   "label name too long",
+			series: []prompb.TimeSeries{newSeries("up", 1, "a_very_long_name", "1")},
+			reason: reasonLabelNameLength,
+		},
+		{
+			name:   "label value too long",
+			series: []prompb.TimeSeries{newSeries("up", 1, "job", strings.Repeat("x", 21))},
+			reason: reasonLabelValueLength,
+		},
+		{
+			name:   "metric name not allowed",
+			series: []prompb.TimeSeries{newSeries("up", 1), newSeries("node_load1", 1)},
+			reason: reasonMetricNameAllowed,
+		},
+		{
+			name:   "patterns are anchored",
+			series: []prompb.TimeSeries{newSeries("upstream", 1)},
+			reason: reasonMetricNameAllowed,
+		},
+		{
+			name:   "metric name denied",
+			series: []prompb.TimeSeries{newSeries("http_debug_requests", 1)},
+			reason: reasonMetricNameDenied,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			forwarded = nil
+			rejected := testutil.ToFloat64(inspector.rejectedSeries.WithLabelValues("limited", tc.reason))
+			rw := push("limited", encodeSeries(t, tc.series...))
+			assert.Equal(t, http.StatusBadRequest, rw.Code)
+			assert.Contains(t, rw.Body.String(), tc.reason)
+			assert.Nil(t, forwarded)
+			assert.Equal(t, rejected+float64(len(tc.series)), testutil.ToFloat64(inspector.rejectedSeries.WithLabelValues("limited", tc.reason)))
+		})
+	}
+
+	rw = push("limited", []byte("not snappy"))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Contains(t, rw.Body.String(), "malformed remote write request")
+	rw = push("limited", snappy.Encode(nil, []byte{0xff, 0xff}))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	// tenants without limits are not decoded at all
+	rw = push("unlimited", []byte("not snappy"))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, []byte("not snappy"), forwarded)
+}
+
+func TestRemoteWriteInspectorBodyLimit(t *testing.T) {
+	defer func(size int64) { maxEncodedSize = size }(maxEncodedSize)
+	maxEncodedSize = 1000
+
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{Authentication: "bearer", Token: "token", ID: "tenant", RemoteWriteLimits: RemoteWriteLimits{MaxSeriesPerRequest: 1}},
+	}})
+	require.NoError(t, err)
+	handler := auth.Wrap(NewRemoteWriteInspector(prometheus.NewRegistry()).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	body := &countingReader{Reader: bytes.NewReader(make([]byte, 1<<20))}
+	req := httptest.NewRequest("POST", "http://localhost/api/v1/push", io.MultiReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+	assert.LessOrEqual(t, body.read, 1001)
+}
+
+func TestInvalidRemoteWriteLimits(t *testing.T) {
+	testCases := []struct {
+		name   string
+		limits RemoteWriteLimits
+	}{
+		{name: "negative limit", limits: RemoteWriteLimits{MaxSeriesPerRequest: -1}},
+		{name: "invalid allowed pattern", limits: RemoteWriteLimits{AllowedMetricNames: []string{"("}}},
+		{name: "invalid denied pattern", limits: RemoteWriteLimits{DeniedMetricNames: []string{"[a-"}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAuthentication(&Config{Tenants: []Tenant{
+				{Authentication: "bearer", Token: "token", ID: "tenant", RemoteWriteLimits: tc.limits},
+			}})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package gateway
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const defaultMaxStaleness = time.Minute
+
+// pathPrefixes are the prefixes the Prometheus API is served under, which
+// return the same results.
+var pathPrefixes = []string{"/prometheus", "/api/prom"}
+
+func (c *QueryCacheConfig) init() error {
+	if c.MaxSizeBytes < 0 || c.MaxEntrySizeBytes < 0 || c.MaxStaleness < 0 {
+		return fmt.Errorf("query cache limits must not be negative")
+	}
+	if c.MaxEntrySizeBytes == 0 {
+		c.MaxEntrySizeBytes = c.MaxSizeBytes / 10
+	}
+	if c.MaxStaleness == 0 {
+		c.MaxStaleness = defaultMaxStaleness
+	}
+	return nil
+}
+
+type cachedResponse struct {
+	key    cacheKey
+	status int
+	header http.Header
+	body   []byte
+	expiry time.Time
+}
+
+func (c *cachedResponse) size() int64 {
+	return int64(len(c.body))
+}
+
+// ResponseCache serves repeated instant and range queries from memory for up
+// to max_staleness. Entries are keyed by the forwarded X-Scope-OrgID, the
+// path without its prefix and the query parameters, and the least recently
+// used ones are evicted once the cache holds max_size_bytes of responses.
+// Range queries are only cached when start and end are aligned to the step,
+// as dashboards do by default, since others are unlikely to be repeated.
+type ResponseCache struct {
+	config   QueryCacheConfig
+	size     int64
+	entries  map[cacheKey]*list.Element
+	lru      *list.List
+	requests *prometheus.CounterVec
+	sync.Mutex
+}
+
+// NewResponseCache returns nil when the cache is disabled.
+func NewResponseCache(config QueryCacheConfig, reg prometheus.Registerer) (*ResponseCache, error) {
+	if err := config.init(); err != nil {
+		return nil, err
+	}
+	if config.MaxSizeBytes == 0 {
+		return nil, nil
+	}
+	return &ResponseCache{
+		config:  config,
+		entries: map[cacheKey]*list.Element{},
+		lru:     list.New(),
+		requests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "gateway_query_cache_requests_total",
+			Help:      "Queries looked up in the query cache, by whether they were served from it.",
+		}, []string{"result"}),
+	}, nil
+}
+
+func (c *ResponseCache) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := c.key(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+			if response, ok := c.get(key, time.Now()); ok {
+				c.requests.WithLabelValues("hit").Inc()
+				for name, values := range response.header {
+					w.Header()[name] = values
+				}
+				w.WriteHeader(response.status)
+				w.Write(response.body)
+				return
+			}
+		}
+		c.requests.WithLabelValues("miss").Inc()
+
+		capture := &responseCapture{ResponseWriter: w, status: http.StatusOK, maxSize: c.config.MaxEntrySizeBytes}
+		next.ServeHTTP(capture, r)
+		if capture.status != http.StatusOK || capture.overflow || strings.Contains(w.Header().Get("Cache-Control"), "no-store") {
+			return
+		}
+		c.set(&cachedResponse{
+			key:    key,
+			status: capture.status,
+			header: w.Header().Clone(),
+			body:   capture.body,
+			expiry: time.Now().Add(c.config.MaxStaleness),
+		})
+	})
+}
+
+// key returns the cache key of the request, or false when it is not cached.
+func (c *ResponseCache) key(r *http.Request) (cacheKey, bool) {
+	path := r.URL.Path
+	for _, prefix := range pathPrefixes {
+		if strings.HasPrefix(path, prefix+"/") {
+			path = strings.TrimPrefix(path, prefix)
+			break
+		}
+	}
+	if path != "/api/v1/query" && path != "/api/v1/query_range" {
+		return cacheKey{}, false
+	}
+	if r.Method != http.MethodGet && !isFormRequest(r) {
+		return cacheKey{}, false
+	}
+
+	params, err := queryParams(r)
+	if err != nil {
+		return cacheKey{}, false
+	}
+	if path == "/api/v1/query_range" && !stepAligned(params.Get("start"), params.Get("end"), params.Get("step")) {
+		return cacheKey{}, false
+	}
+	// the encoding of the cached body has to be acceptable to the client
+	return newCacheKey(r.Header.Get("X-Scope-OrgID"), path, params.Encode(), r.Header.Get("Accept-Encoding")), true
+}
+
+func stepAligned(startParam, endParam, stepParam string) bool {
+	start, err := parseTime(startParam)
+	if err != nil {
+		return false
+	}
+	end, err := parseTime(endParam)
+	if err != nil {
+		return false
+	}
+	step, err := parseDuration(stepParam)
+	if err != nil || step < time.Millisecond {
+		return false
+	}
+	ms := step.Milliseconds()
+	return start.UnixMilli()%ms == 0 && end.UnixMilli()%ms == 0
+}
+
+func (c *ResponseCache) get(key cacheKey, now time.Time) (*cachedResponse, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	response := element.Value.(*cachedResponse)
+	if now.After(response.expiry) {
+		c.remove(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return response, true
+}
+
+func (c *ResponseCache) set(response *cachedResponse) {
+	c.Lock()
+	defer c.Unlock()
+
+	if element, ok := c.entries[response.key]; ok {
+		c.remove(element)
+	}
+	c.entries[response.key] = c.lru.PushFront(response)
+	c.size += response.size()
+	for c.size > c.config.MaxSizeBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *ResponseCache) remove(element *list.Element) {
+	response := c.lru.Remove(element).(*cachedResponse)
+	delete(c.entries, response.key)
+	c.size -= response.size()
+}
+
+// responseCapture keeps a copy of the response it writes through, up to
+// maxSize bytes.
+type responseCapture struct {
+	http.ResponseWriter
+	status   int
+	body     []byte
+	maxSize  int64
+	overflow bool
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if !c.overflow {
+		if int64(len(c.body)+len(b)) > c.maxSize {
+			c.overflow = true
+			c.body = nil
+		} else {
+			c.body = append(c.body, b...)
+		}
+	}
+	return c.ResponseWriter.Write(b)
+}
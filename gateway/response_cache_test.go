@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCache(t *testing.T) {
+	cache, err := NewResponseCache(QueryCacheConfig{MaxSizeBytes: 1000, MaxStaleness: 100 * time.Millisecond}, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	calls := 0
+	status := http.StatusOK
+	handler := cache.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"call":%d}`, calls)
+	}))
+
+	query := func(orgID, method, target, form string) *httptest.ResponseRecorder {
+		var req *http.Request
+		if method == "POST" {
+			req = httptest.NewRequest("POST", "http://localhost"+target, strings.NewReader(form))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest("GET", "http://localhost"+target, nil)
+		}
+		req.Header.Set("X-Scope-OrgID", orgID)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := query("team-a", "GET", "/prometheus/api/v1/query?query=up", "")
+	assert.Equal(t, `{"call":1}`, rw.Body.String())
+
+	// the same query through the other prefix and as a form is a hit
+	rw = query("team-a", "GET", "/api/prom/api/v1/query?query=up", "")
+	assert.Equal(t, `{"call":1}`, rw.Body.String())
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+	assert.Equal(t, `{"call":1}`, query("team-a", "POST", "/prometheus/api/v1/query", "query=up").Body.String())
+
+	// other tenants and parameters are not
+	assert.Equal(t, `{"call":2}`, query("team-b", "GET", "/prometheus/api/v1/query?query=up", "").Body.String())
+	assert.Equal(t, `{"call":3}`, query("team-a", "GET", "/prometheus/api/v1/query?query=up&time=60", "").Body.String())
+
+	// step aligned range queries are cached, others are not
+	aligned := "/prometheus/api/v1/query_range?query=up&start=600&end=1200&step=60"
+	assert.Equal(t, `{"call":4}`, query("team-a", "GET", aligned, "").Body.String())
+	assert.Equal(t, `{"call":4}`, query("team-a", "GET", aligned, "").Body.String())
+	unaligned := "/prometheus/api/v1/query_range?query=up&start=601&end=1201&step=60"
+	assert.Equal(t, `{"call":5}`, query("team-a", "GET", unaligned, "").Body.String())
+	assert.Equal(t, `{"call":6}`, query("team-a", "GET", unaligned, "").Body.String())
+
+	// other endpoints are not cached
+	assert.Equal(t, `{"call":7}`, query("team-a", "GET", "/prometheus/api/v1/series?match[]=up", "").Body.String())
+	assert.Equal(t, `{"call":8}`, query("team-a", "GET", "/prometheus/api/v1/series?match[]=up", "").Body.String())
+
+	// errors are not cached
+	status = http.StatusServiceUnavailable
+	assert.Equal(t, http.StatusServiceUnavailable, query("team-a", "GET", "/prometheus/api/v1/query?query=down", "").Code)
+	status = http.StatusOK
+	assert.Equal(t, `{"call":10}`, query("team-a", "GET", "/prometheus/api/v1/query?query=down", "").Body.String())
+
+	// entries expire after max_staleness
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, `{"call":11}`, query("team-a", "GET", "/prometheus/api/v1/query?query=up", "").Body.String())
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(cache.requests.WithLabelValues("hit")))
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	cache, err := NewResponseCache(QueryCacheConfig{MaxSizeBytes: 30, MaxEntrySizeBytes: 20}, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	calls := map[string]int{}
+	handler := cache.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		calls[query]++
+		if query == "big" {
+			w.Write(make([]byte, 21))
+			return
+		}
+		w.Write(make([]byte, 10))
+	}))
+	query := func(q string, header ...string) {
+		req := httptest.NewRequest("GET", "http://localhost/prometheus/api/v1/query?query="+q, nil)
+		if len(header) > 0 {
+			req.Header.Set("Cache-Control", header[0])
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	query("a")
+	query("b")
+	query("c")
+	query("a")
+	// d evicts b, the least recently used
+	query("d")
+	query("a")
+	query("b")
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "c": 1, "d": 1}, calls)
+
+	// responses over the entry size are not cached
+	query("big")
+	query("big")
+	assert.Equal(t, 2, calls["big"])
+
+	// no-cache skips the lookup
+	query("a", "no-cache")
+	assert.Equal(t, 2, calls["a"])
+}
+
+func TestDisabledResponseCache(t *testing.T) {
+	cache, err := NewResponseCache(QueryCacheConfig{}, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	assert.Nil(t, cache)
+
+	_, err = NewResponseCache(QueryCacheConfig{MaxSizeBytes: -1}, prometheus.NewRegistry())
+	assert.Error(t, err)
+}
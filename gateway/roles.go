@@ -0,0 +1,73 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+const (
+	roleWrite       = "write"
+	roleRead        = "read"
+	roleRulesAdmin  = "rules-admin"
+	roleAlertsAdmin = "alerts-admin"
+)
+
+// componentRoles maps each component to the role required to reach it.
+var componentRoles = map[string]string{
+	DISTRIBUTOR:  roleWrite,
+	FRONTEND:     roleRead,
+	RULER:        roleRulesAdmin,
+	ALERTMANAGER: roleAlertsAdmin,
+}
+
+func validateRoles(roles []string) error {
+	for _, role := range roles {
+		switch role {
+		case roleWrite, roleRead, roleRulesAdmin, roleAlertsAdmin:
+		default:
+			return fmt.Errorf("invalid role %q, valid options: %s, %s, %s, %s", role, roleWrite, roleRead, roleRulesAdmin, roleAlertsAdmin)
+		}
+	}
+	return nil
+}
+
+type identityKey struct{}
+
+// identity is what a request was authenticated as. credential is nil for
+// authentication methods that do not use the tenant's credentials.
+type identity struct {
+	tenant     *Tenant
+	credential *Credential
+}
+
+func withIdentity(r *http.Request, id identity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+}
+
+func identityFrom(ctx context.Context) (identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(identity)
+	return id, ok
+}
+
+// roles returns the roles of the credential, falling back to the tenant's.
+// No roles at all means no restrictions.
+func (id identity) roles() []string {
+	if id.credential != nil && len(id.credential.Roles) > 0 {
+		return id.credential.Roles
+	}
+	return id.tenant.Roles
+}
+
+func (id identity) hasRole(role string) bool {
+	roles := id.roles()
+	if len(roles) == 0 {
+		return true
+	}
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
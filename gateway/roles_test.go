@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoles(t *testing.T) {
+	auth, err := NewAuthentication(&Config{Tenants: []Tenant{
+		{
+			Authentication: "basic",
+			ID:             "orgid",
+			Credentials: []Credential{
+				{Username: "prometheus", Password: "push", Roles: []string{roleWrite}},
+				{Username: "grafana", Password: "query", Roles: []string{roleRead}},
+				{Username: "admin", Password: "admin"},
+			},
+			Roles: []string{roleRulesAdmin, roleAlertsAdmin},
+		},
+		{Authentication: "bearer", Token: "token", ID: "orgid", Roles: []string{roleRead, roleWrite}},
+		{Authentication: "api_key", APIKey: APIKeyConfig{Key: "key"}, ID: "orgid"},
+	}})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("/api/v1/push", authorize(DISTRIBUTOR, ok))
+	mux.Handle("/prometheus/api/v1/query", authorize(FRONTEND, ok))
+	mux.Handle("/ruler/delete_tenant_config", authorize(RULER, ok))
+	mux.Handle("/multitenant_alertmanager/delete_tenant_config", authorize(ALERTMANAGER, ok))
+	handler := auth.Wrap(mux)
+
+	testCases := []struct {
+		name     string
+		setAuth  func(r *http.Request)
+		expected map[string]int
+	}{
+		{
+			name:    "write-only credential",
+			setAuth: func(r *http.Request) { r.SetBasicAuth("prometheus", "push") },
+			expected: map[string]int{
+				"/api/v1/push":                                   http.StatusOK,
+				"/prometheus/api/v1/query":                       http.StatusForbidden,
+				"/ruler/delete_tenant_config":                    http.StatusForbidden,
+				"/multitenant_alertmanager/delete_tenant_config": http.StatusForbidden,
+			},
+		},
+		{
+			name:    "read-only credential",
+			setAuth: func(r *http.Request) { r.SetBasicAuth("grafana", "query") },
+			expected: map[string]int{
+				"/api/v1/push":                                   http.StatusForbidden,
+				"/prometheus/api/v1/query":                       http.StatusOK,
+				"/ruler/delete_tenant_config":                    http.StatusForbidden,
+				"/multitenant_alertmanager/delete_tenant_config": http.StatusForbidden,
+			},
+		},
+		{
+			name:    "credential without roles falls back to the tenant roles",
+			setAuth: func(r *http.Request) { r.SetBasicAuth("admin", "admin") },
+			expected: map[string]int{
+				"/api/v1/push":                                   http.StatusForbidden,
+				"/prometheus/api/v1/query":                       http.StatusForbidden,
+				"/ruler/delete_tenant_config":                    http.StatusOK,
+				"/multitenant_alertmanager/delete_tenant_config": http.StatusOK,
+			},
+		},
+		{
+			name:    "tenant roles",
+			setAuth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") },
+			expected: map[string]int{
+				"/api/v1/push":                                   http.StatusOK,
+				"/prometheus/api/v1/query":                       http.StatusOK,
+				"/ruler/delete_tenant_config":                    http.StatusForbidden,
+				"/multitenant_alertmanager/delete_tenant_config": http.StatusForbidden,
+			},
+		},
+		{
+			name:    "no roles",
+			setAuth: func(r *http.Request) { r.Header.Set(defaultAPIKeyHeader, "key") },
+			expected: map[string]int{
+				"/api/v1/push":                                   http.StatusOK,
+				"/prometheus/api/v1/query":                       http.StatusOK,
+				"/ruler/delete_tenant_config":                    http.StatusOK,
+				"/multitenant_alertmanager/delete_tenant_config": http.StatusOK,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for path, expectedStatus := range tc.expected {
+				req := httptest.NewRequest("POST", "http://localhost"+path, nil)
+				tc.setAuth(req)
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+				assert.Equal(t, expectedStatus, rw.Code, path)
+			}
+		})
+	}
+}
+
+func TestInvalidRoles(t *testing.T) {
+	testCases := []struct {
+		name   string
+		tenant Tenant
+	}{
+		{
+			name:   "unknown tenant role",
+			tenant: Tenant{Authentication: "mtls", Roles: []string{"admin"}},
+		},
+		{
+			name:   "unknown credential role",
+			tenant: Tenant{Authentication: "bearer", Credentials: []Credential{{Token: "token", Roles: []string{"delete"}}}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAuthentication(&Config{Tenants: []Tenant{tc.tenant}})
+			assert.ErrorContains(t, err, "invalid role")
+		})
+	}
+}
@@ -23,15 +23,21 @@ func main() {
 	conf, err := gateway.Init(filePath)
 	utils.CheckErr("reading the configuration file", err)
 
+	auth, err := gateway.NewAuthentication(&conf)
+	utils.CheckErr("initializing the authentication", err)
+
 	serverConf := server.Config{
 		HTTPListenAddr: conf.Server.Address,
 		HTTPListenPort: conf.Server.Port,
 		HTTPMiddleware: []middleware.Interface{
-			gateway.NewAuthentication(&conf),
+			auth,
 		},
 		HTTPServerReadTimeout:              conf.Server.ReadTimeout,
 		HTTPServerWriteTimeout:             conf.Server.WriteTimeout,
 		HTTPServerIdleTimeout:              conf.Server.IdleTimeout,
+		HTTPTLSCertFile:                    conf.Server.TLS.CertFile,
+		HTTPTLSKeyFile:                     conf.Server.TLS.KeyFile,
+		HTTPTLSClientCAFile:                conf.Server.TLS.ClientCAFile,
 		UnAuthorizedHTTPListenAddr:         conf.Admin.Address,
 		UnAuthorizedHTTPListenPort:         conf.Admin.Port,
 		UnAuthorizedHTTPServerReadTimeout:  conf.Admin.ReadTimeout,
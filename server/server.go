@@ -2,11 +2,14 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"os"
 	"time"
 
 	"github.com/cortexproject/auth-gateway/middleware"
@@ -33,6 +36,9 @@ type Config struct {
 	HTTPServerReadTimeout  time.Duration
 	HTTPServerWriteTimeout time.Duration
 	HTTPServerIdleTimeout  time.Duration
+	HTTPTLSCertFile        string
+	HTTPTLSKeyFile         string
+	HTTPTLSClientCAFile    string
 
 	UnAuthorizedHTTPRouter             *http.ServeMux
 	UnAuthorizedHTTPListenAddr         string
@@ -65,11 +71,18 @@ func initAuthServer(cfg *Config, middlewares []middleware.Interface) (*server, e
 		return nil, err
 	}
 	cfg.HTTPListenPort = port
+	tlsConfig, err := newTLSConfig(cfg.HTTPTLSCertFile, cfg.HTTPTLSKeyFile, cfg.HTTPTLSClientCAFile)
+	if err != nil {
+		return nil, err
+	}
 	listenAddr := fmt.Sprintf("%s:%d", cfg.HTTPListenAddr, port)
 	httpListener, err := net.Listen(DefaultNetwork, listenAddr)
 	if err != nil {
 		return nil, err
 	}
+	if tlsConfig != nil {
+		httpListener = tls.NewListener(httpListener, tlsConfig)
+	}
 
 	var router *http.ServeMux
 	if cfg.HTTPRouter != nil {
@@ -112,6 +125,7 @@ func initAuthServer(cfg *Config, middlewares []middleware.Interface) (*server, e
 		WriteTimeout: writeTimeout,
 		IdleTimeout:  idleTimeout,
 		ErrorLog:     log.New(utils.LogrusErrorWriter{}, "", 0),
+		TLSConfig:    tlsConfig,
 	}
 
 	return &server{
@@ -121,6 +135,47 @@ func initAuthServer(cfg *Config, middlewares []middleware.Interface) (*server, e
 	}, nil
 }
 
+// newTLSConfig returns nil when no certificate is configured, in which case
+// the server keeps serving plain HTTP.
+func newTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, fmt.Errorf("a client CA requires a TLS certificate and key")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("both a TLS certificate and key are required")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		// client certificates are optional so that tenants using other
+		// authentication methods can still connect
+		ClientAuth: tls.RequestClientCert,
+	}
+
+	if clientCAFile != "" {
+		caCert, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
+
 func initUnAuthServer(cfg *Config, middlewares []middleware.Interface) (*server, error) {
 	port, err := checkPort(cfg.UnAuthorizedHTTPListenAddr, cfg.UnAuthorizedHTTPListenPort, DefaultUnauthPort, DefaultNetwork)
 	if err != nil {
@@ -306,6 +361,11 @@ func (s *Server) GetHTTPHandlers() (http.Handler, http.Handler) {
 	return s.authServer.http, s.unAuthServer.http
 }
 
+// Registerer returns the registry served on the /metrics endpoint.
+func (s *Server) Registerer() prometheus.Registerer {
+	return s.promRegistery
+}
+
 func checkPortAvailable(addr string, port int, network string) bool {
 	l, err := net.Listen(network, fmt.Sprintf("%s:%d", addr, port))
 	if err != nil {
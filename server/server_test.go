@@ -1,17 +1,31 @@
 package server
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNew(t *testing.T) {
@@ -145,6 +159,28 @@ func TestServer_RegisterTo(t *testing.T) {
 	}
 }
 
+func TestRegisterer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	s := &Server{
+		promRegistery: reg,
+		unAuthServer: &server{
+			http: http.NewServeMux(),
+		},
+	}
+	registerEndpoints(s.unAuthServer, reg, s)
+
+	promauto.With(s.Registerer()).NewCounter(prometheus.CounterOpts{
+		Name: "test_registerer_total",
+		Help: "Test counter.",
+	}).Inc()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	s.unAuthServer.http.ServeHTTP(w, req)
+
+	assert.Contains(t, w.Body.String(), "test_registerer_total 1")
+}
+
 func TestRun(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -328,3 +364,212 @@ func TestCheckPortAvailable(t *testing.T) {
 		})
 	}
 }
+
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	tc := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, "cert.pem"),
+		keyFile:  filepath.Join(dir, "key.pem"),
+	}
+	require.NoError(t, os.WriteFile(tc.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(tc.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return tc
+}
+
+func (tc *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{tc.cert.Raw}, PrivateKey: tc.key}
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	serverCert := newTestCert(t, "localhost", ca, false)
+	clientCert := newTestCert(t, "client", ca, false)
+	untrustedCert := newTestCert(t, "untrusted", nil, false)
+
+	router := http.NewServeMux()
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+		}
+	})
+
+	s, err := New(Config{
+		HTTPRouter:                    router,
+		HTTPListenAddr:                "localhost",
+		HTTPListenPort:                8094,
+		HTTPTLSCertFile:               serverCert.certFile,
+		HTTPTLSKeyFile:                serverCert.keyFile,
+		HTTPTLSClientCAFile:           ca.certFile,
+		UnAuthorizedHTTPListenAddr:    "localhost",
+		UnAuthorizedHTTPListenPort:    8095,
+		ServerGracefulShutdownTimeout: time.Second,
+	})
+	require.NoError(t, err)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.Run()
+	}()
+	defer func() {
+		s.authServer.httpServer.Close()
+		s.unAuthServer.httpServer.Close()
+		assert.NoError(t, <-errChan)
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	tests := []struct {
+		name         string
+		clientCerts  []tls.Certificate
+		wantErr      bool
+		expectedBody string
+	}{
+		{
+			name:         "trusted client certificate",
+			clientCerts:  []tls.Certificate{clientCert.tlsCertificate()},
+			expectedBody: "client",
+		},
+		{
+			name:         "no client certificate",
+			expectedBody: "",
+		},
+		{
+			name:        "untrusted client certificate",
+			clientCerts: []tls.Certificate{untrustedCert.tlsCertificate()},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig := &tls.Config{RootCAs: roots}
+			if len(tt.clientCerts) > 0 {
+				// always present the certificate, even when the server does not list its issuer
+				tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &tt.clientCerts[0], nil
+				}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			resp, err := client.Get("https://localhost:8094/")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.expectedBody, readAll(t, resp))
+		})
+	}
+}
+
+func readAll(t *testing.T, resp *http.Response) string {
+	buf := new(strings.Builder)
+	_, err := io.Copy(buf, resp.Body)
+	require.NoError(t, err)
+	return buf.String()
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	cert := newTestCert(t, "localhost", nil, false)
+
+	tests := []struct {
+		name           string
+		certFile       string
+		keyFile        string
+		clientCAFile   string
+		wantNil        bool
+		wantErr        bool
+		wantClientAuth tls.ClientAuthType
+	}{
+		{
+			name:    "plain HTTP",
+			wantNil: true,
+		},
+		{
+			name:     "missing key",
+			certFile: cert.certFile,
+			wantErr:  true,
+		},
+		{
+			name:         "client CA without a certificate",
+			clientCAFile: cert.certFile,
+			wantErr:      true,
+		},
+		{
+			name:         "invalid client CA",
+			certFile:     cert.certFile,
+			keyFile:      cert.keyFile,
+			clientCAFile: cert.keyFile,
+			wantErr:      true,
+		},
+		{
+			name:           "without client CA",
+			certFile:       cert.certFile,
+			keyFile:        cert.keyFile,
+			wantClientAuth: tls.RequestClientCert,
+		},
+		{
+			name:           "with client CA",
+			certFile:       cert.certFile,
+			keyFile:        cert.keyFile,
+			clientCAFile:   cert.certFile,
+			wantClientAuth: tls.VerifyClientCertIfGiven,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := newTLSConfig(tt.certFile, tt.keyFile, tt.clientCAFile)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantNil {
+				assert.Nil(t, tlsConfig)
+				return
+			}
+			assert.Equal(t, tt.wantClientAuth, tlsConfig.ClientAuth)
+		})
+	}
+}